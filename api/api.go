@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gr-butler/weather/db/postgres"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+The station's REST api, everything is under /api/v1 so it can change without
+breaking anyone. Times are RFC3339 and every value says its unit in its name.
+
+Lists are paged, at most limit rows (default 1000) come back and if there are
+more the response has a next link (and a Link header) for the rest. Add
+format=csv, or send Accept: text/csv, to get CSV instead of JSON.
+*/
+
+const (
+	defaultLimit = 1000
+	maxLimit     = 10000
+)
+
+// Server answers the api requests
+type Server struct {
+	db      postgres.Querier
+	loc     *time.Location
+	station Station
+	latest  func() (Current, bool)
+}
+
+// New makes a Server, days and months are in loc, the station's time zone. latest
+// gives the current conditions, false if there haven't been any yet.
+func New(db postgres.Querier, loc *time.Location, station Station, latest func() (Current, bool)) *Server {
+	return &Server{db: db, loc: loc, station: station, latest: latest}
+}
+
+// Register adds the api to mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/current", s.current)
+	mux.HandleFunc("GET /api/v1/observations", s.observations)
+	mux.HandleFunc("GET /api/v1/summary/daily", s.dailySummary)
+}
+
+// row is one line of a list
+type row interface {
+	at() time.Time
+	csv() []string
+}
+
+// page is a list in JSON
+type page[T row] struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Interval string    `json:"interval,omitempty"`
+	Next     string    `json:"next,omitempty"`
+	Data     []T       `json:"data"`
+}
+
+// writePage sends p, rows has up to limit+1 in it, the extra one is where the next page starts
+func writePage[T row](rw http.ResponseWriter, r *http.Request, header []string, p page[T], limit int) {
+	if len(p.Data) > limit {
+		q := r.URL.Query()
+		q.Set("from", p.Data[limit].at().UTC().Format(time.RFC3339Nano))
+		p.Next = r.URL.Path + "?" + q.Encode()
+		p.Data = p.Data[:limit]
+		rw.Header().Set("Link", fmt.Sprintf("<%v>; rel=\"next\"", p.Next))
+	}
+	if p.Data == nil {
+		p.Data = []T{}
+	}
+
+	if wantsCSV(r) {
+		rw.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(rw)
+		_ = cw.Write(header)
+		for _, d := range p.Data {
+			_ = cw.Write(d.csv())
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			logger.Errorf("Failed to write CSV [%v]", err)
+		}
+		return
+	}
+	writeJSON(rw, p)
+}
+
+func writeJSON(rw http.ResponseWriter, v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		logger.Errorf("JSON error [%v]", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write(js) // not much we can do if this fails
+}
+
+func wantsCSV(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// badRequest is for anything wrong with the query string
+func badRequest(rw http.ResponseWriter, err error) {
+	http.Error(rw, err.Error(), http.StatusBadRequest)
+}
+
+// dbError is for the db failing, the details go in the log
+func dbError(rw http.ResponseWriter, err error) {
+	logger.Errorf("API db query failed [%v]", err)
+	http.Error(rw, "database error", http.StatusInternalServerError)
+}
+
+func pageLimit(r *http.Request) (int, error) {
+	l := r.URL.Query().Get("limit")
+	if l == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("limit must be 1 to %v", maxLimit)
+	}
+	return limit, nil
+}
+
+// parseTime takes RFC3339 or a date, which is midnight local time
+func (s *Server) parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, s.loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown time [%v], use RFC3339 or 2006-01-02", v)
+	}
+	return t, nil
+}
+
+// a value that can be missing, null in JSON and empty in CSV
+func null(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func csvFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/data"
+	"github.com/gr-butler/weather/db"
+	"github.com/gr-butler/weather/db/postgres"
+	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/rollup"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore is a SQLite db with a day of records every 15 minutes from 09:15 on the 1st of March
+func testStore(t *testing.T) *db.Store {
+	ctx := context.Background()
+	cfg := env.Default().Database
+	cfg.Driver = db.SQLite
+	cfg.Path = filepath.Join(t.TempDir(), "weather.db")
+	s, err := db.Open(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	m, err := s.Migrator()
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 1; i <= 96; i++ {
+		rec := postgres.WriteRecordParams{
+			RecordDate:  start.Add(time.Duration(i) * 15 * time.Minute),
+			Temperature: sql.NullFloat64{Float64: float64(i), Valid: true},
+			RainMm:      0.5,
+		}
+		if i == 2 {
+			rec.Temperature.Valid = false
+		}
+		require.NoError(t, s.WriteRecord(ctx, rec))
+	}
+	_, err = rollup.New(s, time.UTC).Backfill(ctx, time.Time{}, start.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	return s
+}
+
+func get(t *testing.T, s *Server, url string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	s.Register(mux)
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, url, nil))
+	return rw
+}
+
+func TestObservations(t *testing.T) {
+	s := New(testStore(t), time.UTC, Station{}, nil)
+
+	rw := get(t, s, "/api/v1/observations?from=2025-03-01T09:00:00Z&to=2025-03-02T09:00:00Z&limit=50")
+	require.Equal(t, http.StatusOK, rw.Code)
+	var p page[Observation]
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &p))
+	require.Len(t, p.Data, 50)
+	require.Equal(t, 1.0, *p.Data[0].TemperatureC)
+	require.Nil(t, p.Data[1].TemperatureC)
+	require.NotEmpty(t, p.Next)
+	require.Contains(t, rw.Header().Get("Link"), `rel="next"`)
+
+	// the next page picks up where that one stopped
+	rw = get(t, s, p.Next)
+	require.Equal(t, http.StatusOK, rw.Code)
+	var next page[Observation]
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &next))
+	// to isn't included
+	require.Len(t, next.Data, 45)
+	require.Equal(t, 51.0, *next.Data[0].TemperatureC)
+	require.Empty(t, next.Next)
+
+	rw = get(t, s, "/api/v1/observations?from=2025-03-01&to=2025-03-03&interval=hour&format=csv")
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Equal(t, "text/csv", rw.Header().Get("Content-Type"))
+	lines, err := csv.NewReader(rw.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, lines, 25)
+	require.Equal(t, summaryHeader, lines[0])
+	require.Equal(t, []string{"2025-03-01T09:00:00Z", "4"}, lines[1][:2])
+	require.Equal(t, "2", lines[1][9])
+
+	for _, bad := range []string{"interval=week", "from=yesterday", "limit=0", "from=2025-03-02&to=2025-03-01"} {
+		rw = get(t, s, "/api/v1/observations?"+bad)
+		require.Equal(t, http.StatusBadRequest, rw.Code, bad)
+	}
+}
+
+func TestDailySummary(t *testing.T) {
+	s := New(testStore(t), time.UTC, Station{}, nil)
+
+	rw := get(t, s, "/api/v1/summary/daily?month=2025-03")
+	require.Equal(t, http.StatusOK, rw.Code)
+	var p page[Summary]
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &p))
+	require.Len(t, p.Data, 1)
+	day := p.Data[0]
+	require.Equal(t, 96, day.Samples)
+	require.Equal(t, 48.0, day.RainMM)
+	require.Equal(t, 1.0, *day.TempMinC)
+	require.Equal(t, 96.0, *day.TempMaxC)
+
+	rw = get(t, s, "/api/v1/summary/daily?month=2025-02")
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &p))
+	require.Empty(t, p.Data)
+}
+
+func TestCurrent(t *testing.T) {
+	var latest *Current
+	s := New(nil, time.UTC, Station{ID: "test", Software: "GRB-Weather"}, func() (Current, bool) {
+		if latest == nil {
+			return Current{}, false
+		}
+		return *latest, true
+	})
+
+	rw := get(t, s, "/api/v1/current")
+	require.Equal(t, http.StatusServiceUnavailable, rw.Code)
+
+	o := data.Observation{
+		Time:         time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC),
+		TemperatureC: data.Value(10),
+		Humidity:     data.Value(80),
+		PressureHpa:  data.Value(1000),
+		WindSpeed:    data.Value(10),
+		WindGust:     data.NoValue("disabled"),
+	}
+	o.PressureHpa.Flag(data.Bad, "step")
+	dew := 6.0
+	latest = &Current{Observation: o, DewPointC: &dew, Sensors: map[string]bool{"wind": true}}
+
+	rw = get(t, s, "/api/v1/current?units=imperial")
+	require.Equal(t, http.StatusOK, rw.Code)
+	var c Conditions
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &c))
+	require.Equal(t, "test", c.Station.ID)
+	require.Equal(t, "2025-03-01T09:00:00Z", c.Time.Format(time.RFC3339))
+	require.True(t, c.Sensors["wind"])
+	require.Equal(t, Reading{Value: ptr(50), Unit: "F", Quality: "good"}, c.Readings["temperature"])
+	require.Equal(t, Reading{Unit: "inHg", Quality: "bad", Reason: "step"}, c.Readings["pressure"])
+	require.Equal(t, Reading{Unit: "inHg", Quality: "missing", Reason: "not available"}, c.Readings["mslp"])
+	require.Equal(t, "missing", c.Readings["wind_gust"].Quality)
+	require.InDelta(t, 42.8, *c.Readings["dew_point"].Value, 0.0001)
+
+	rw = get(t, s, "/api/v1/current?units=si")
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &c))
+	require.InDelta(t, 4.4704, *c.Readings["wind_speed"].Value, 0.0001)
+	require.Equal(t, "m/s", c.Readings["wind_speed"].Unit)
+
+	rw = get(t, s, "/api/v1/current?units=furlongs")
+	require.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gr-butler/weather/data"
+	"github.com/gr-butler/weather/env"
+)
+
+// Station is who is answering, it goes in every current conditions response
+type Station struct {
+	ID        string  `json:"id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	AltitudeM float64 `json:"altitude_m"`
+	Software  string  `json:"software"`
+}
+
+// Current is the latest observation after QC, with the values worked out from it.
+// The station hands one over after each observation.
+type Current struct {
+	Observation data.Observation
+	DewPointC   *float64
+	MSLPHpa     *float64
+	RainDayMM   *float64
+	// which sensors are switched on
+	Sensors map[string]bool
+}
+
+// Reading is one value in the units asked for. A reading that is missing or
+// failed QC has no value and the quality says why.
+type Reading struct {
+	Value   *float64 `json:"value"`
+	Unit    string   `json:"unit"`
+	Quality string   `json:"quality"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+// Conditions is the readings in one set of units, it's what /api/v1/current sends
+// and what the live stream sends
+type Conditions struct {
+	Station  Station            `json:"station"`
+	Time     time.Time          `json:"time"`
+	Units    string             `json:"units"`
+	Sensors  map[string]bool    `json:"sensors,omitempty"`
+	Readings map[string]Reading `json:"readings"`
+}
+
+// the units for each system, the station measures in C, hPa, mm and mph
+type units struct {
+	temperature, pressure, rain, rate, speed string
+}
+
+var unitSystems = map[string]units{
+	"metric":   {temperature: "C", pressure: "hPa", rain: "mm", rate: "mm/h", speed: "km/h"},
+	"imperial": {temperature: "F", pressure: "inHg", rain: "in", rate: "in/h", speed: "mph"},
+	"si":       {temperature: "K", pressure: "Pa", rain: "mm", rate: "mm/h", speed: "m/s"},
+}
+
+// of is the unit a reading is in
+func (u units) of(name string) string {
+	switch name {
+	case "temperature", "dew_point":
+		return u.temperature
+	case "pressure", "mslp":
+		return u.pressure
+	case "rain_day":
+		return u.rain
+	case "rain_rate":
+		return u.rate
+	case "wind_speed", "wind_gust":
+		return u.speed
+	case "humidity":
+		return "%"
+	}
+	return "deg"
+}
+
+func convert(v float64, unit string) float64 {
+	switch unit {
+	case "F":
+		return v*9/5 + 32
+	case "K":
+		return v + 273.15
+	case "inHg":
+		return v * env.HPaToInHg
+	case "Pa":
+		return v * 100
+	case "in", "in/h":
+		return v / 25.4
+	case "km/h":
+		return v * 1.609344
+	case "m/s":
+		return v * 0.44704
+	}
+	return v
+}
+
+func reading(r data.Reading, unit string) Reading {
+	out := Reading{Unit: unit, Quality: r.Quality.String(), Reason: r.Reason}
+	if r.Usable() {
+		v := convert(r.Value, unit)
+		out.Value = &v
+	}
+	return out
+}
+
+// derived is a value worked out from other readings, it's only as good as the worst of them
+func derived(v *float64, unit string, from ...data.Reading) Reading {
+	r := data.Reading{Quality: data.Missing, Reason: "not available"}
+	if v != nil {
+		r = data.Value(*v)
+		for _, f := range from {
+			r.Flag(f.Quality, f.Reason)
+		}
+	}
+	return reading(r, unit)
+}
+
+// Conditions is c in the units asked for, metric, imperial or si
+func (s *Server) Conditions(c Current, name string) (Conditions, error) {
+	u, ok := unitSystems[name]
+	if !ok {
+		return Conditions{}, fmt.Errorf("unknown units [%v], use metric, imperial or si", name)
+	}
+	o := c.Observation
+	return Conditions{
+		Station: s.station,
+		Time:    o.Time.UTC(),
+		Units:   name,
+		Sensors: c.Sensors,
+		Readings: map[string]Reading{
+			"temperature":         reading(o.TemperatureC, u.of("temperature")),
+			"humidity":            reading(o.Humidity, u.of("humidity")),
+			"dew_point":           derived(c.DewPointC, u.of("dew_point"), o.TemperatureC, o.Humidity),
+			"pressure":            reading(o.PressureHpa, u.of("pressure")),
+			"mslp":                derived(c.MSLPHpa, u.of("mslp"), o.PressureHpa, o.TemperatureC),
+			"rain_rate":           reading(o.RainRate, u.of("rain_rate")),
+			"rain_day":            derived(c.RainDayMM, u.of("rain_day")),
+			"wind_speed":          reading(o.WindSpeed, u.of("wind_speed")),
+			"wind_direction":      reading(o.WindDir, u.of("wind_direction")),
+			"wind_gust":           reading(o.WindGust, u.of("wind_gust")),
+			"wind_gust_direction": reading(o.WindGustDir, u.of("wind_gust_direction")),
+		},
+	}, nil
+}
+
+// Update is a few readings taken at t, in metric. The values are in the station's
+// units (C, hPa, mm and mph) with the same names as Conditions.
+func (s *Server) Update(t time.Time, readings map[string]data.Reading) Conditions {
+	u := unitSystems["metric"]
+	out := Conditions{Station: s.station, Time: t.UTC(), Units: "metric", Readings: map[string]Reading{}}
+	for name, r := range readings {
+		out.Readings[name] = reading(r, u.of(name))
+	}
+	return out
+}
+
+// current is the latest observation
+//
+//	/api/v1/current?units=metric|imperial|si
+func (s *Server) current(rw http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("units")
+	if name == "" {
+		name = "metric"
+	}
+	c, ok := s.latest()
+	out, err := s.Conditions(c, name)
+	if err != nil {
+		badRequest(rw, err)
+		return
+	}
+	if !ok {
+		http.Error(rw, "no observation yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(rw, out)
+}
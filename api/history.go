@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gr-butler/weather/clock"
+	"github.com/gr-butler/weather/db/postgres"
+	"github.com/gr-butler/weather/rollup"
+)
+
+// Observation is one db record, anything that failed QC is null
+type Observation struct {
+	Time                 time.Time `json:"time"`
+	TemperatureC         *float64  `json:"temperature_c"`
+	HumidityPct          *float64  `json:"humidity_pct"`
+	DewPointC            *float64  `json:"dew_point_c"`
+	PressureHpa          *float64  `json:"pressure_hpa"`
+	MSLPHpa              *float64  `json:"mslp_hpa"`
+	RainMM               float64   `json:"rain_mm"`
+	RainRateMMHr         *float64  `json:"rain_rate_mm_hr"`
+	WindSpeedMph         *float64  `json:"wind_speed_mph"`
+	WindDirectionDeg     *float64  `json:"wind_direction_deg"`
+	WindGustMph          *float64  `json:"wind_gust_mph"`
+	WindGustDirectionDeg *float64  `json:"wind_gust_direction_deg"`
+}
+
+var observationHeader = []string{"time", "temperature_c", "humidity_pct", "dew_point_c", "pressure_hpa", "mslp_hpa",
+	"rain_mm", "rain_rate_mm_hr", "wind_speed_mph", "wind_direction_deg", "wind_gust_mph", "wind_gust_direction_deg"}
+
+func newObservation(w postgres.Weather) Observation {
+	return Observation{
+		Time:                 w.RecordDate.UTC(),
+		TemperatureC:         null(w.Temperature),
+		HumidityPct:          null(w.Humidity),
+		DewPointC:            null(w.DewPoint),
+		PressureHpa:          null(w.Pressure),
+		MSLPHpa:              null(w.Mslp),
+		RainMM:               w.RainMm,
+		RainRateMMHr:         null(w.RainRate),
+		WindSpeedMph:         null(w.WindSpeed),
+		WindDirectionDeg:     null(w.WindDirection),
+		WindGustMph:          null(w.WindGust),
+		WindGustDirectionDeg: null(w.WindGustDirection),
+	}
+}
+
+func (o Observation) at() time.Time { return o.Time }
+
+func (o Observation) csv() []string {
+	return []string{o.Time.Format(time.RFC3339), csvFloat(o.TemperatureC), csvFloat(o.HumidityPct), csvFloat(o.DewPointC),
+		csvFloat(o.PressureHpa), csvFloat(o.MSLPHpa), csvFloat(&o.RainMM), csvFloat(o.RainRateMMHr), csvFloat(o.WindSpeedMph),
+		csvFloat(o.WindDirectionDeg), csvFloat(o.WindGustMph), csvFloat(o.WindGustDirectionDeg)}
+}
+
+// Summary is an hour, day or month from the rollups
+type Summary struct {
+	Start               time.Time  `json:"start"`
+	Samples             int        `json:"samples"`
+	TempMinC            *float64   `json:"temp_min_c"`
+	TempMaxC            *float64   `json:"temp_max_c"`
+	TempMeanC           *float64   `json:"temp_mean_c"`
+	PressureMinHpa      *float64   `json:"pressure_min_hpa"`
+	PressureMaxHpa      *float64   `json:"pressure_max_hpa"`
+	MSLPMinHpa          *float64   `json:"mslp_min_hpa"`
+	MSLPMaxHpa          *float64   `json:"mslp_max_hpa"`
+	RainMM              float64    `json:"rain_mm"`
+	WindMeanMph         *float64   `json:"wind_mean_mph"`
+	WindPrevailingDeg   *float64   `json:"wind_prevailing_deg"`
+	GustMaxMph          *float64   `json:"gust_max_mph"`
+	GustTime            *time.Time `json:"gust_time"`
+	GustMaxDirectionDeg *float64   `json:"gust_max_direction_deg"`
+}
+
+var summaryHeader = []string{"start", "samples", "temp_min_c", "temp_max_c", "temp_mean_c", "pressure_min_hpa", "pressure_max_hpa",
+	"mslp_min_hpa", "mslp_max_hpa", "rain_mm", "wind_mean_mph", "wind_prevailing_deg", "gust_max_mph", "gust_time", "gust_max_direction_deg"}
+
+// the rollup tables all have the same columns, the daily and monthly rows convert to this
+func newSummary(w postgres.WeatherHourly) Summary {
+	s := Summary{
+		Start:               w.PeriodStart.UTC(),
+		Samples:             int(w.Samples),
+		TempMinC:            null(w.TempMin),
+		TempMaxC:            null(w.TempMax),
+		TempMeanC:           null(w.TempMean),
+		PressureMinHpa:      null(w.PressureMin),
+		PressureMaxHpa:      null(w.PressureMax),
+		MSLPMinHpa:          null(w.MslpMin),
+		MSLPMaxHpa:          null(w.MslpMax),
+		RainMM:              w.RainMm,
+		WindMeanMph:         null(w.WindMean),
+		WindPrevailingDeg:   null(w.WindPrevailing),
+		GustMaxMph:          null(w.GustMax),
+		GustMaxDirectionDeg: null(w.GustDirection),
+	}
+	if w.GustTime.Valid {
+		t := w.GustTime.Time.UTC()
+		s.GustTime = &t
+	}
+	return s
+}
+
+func (s Summary) at() time.Time { return s.Start }
+
+func (s Summary) csv() []string {
+	gust := ""
+	if s.GustTime != nil {
+		gust = s.GustTime.Format(time.RFC3339)
+	}
+	return []string{s.Start.Format(time.RFC3339), strconv.Itoa(s.Samples), csvFloat(s.TempMinC), csvFloat(s.TempMaxC),
+		csvFloat(s.TempMeanC), csvFloat(s.PressureMinHpa), csvFloat(s.PressureMaxHpa), csvFloat(s.MSLPMinHpa),
+		csvFloat(s.MSLPMaxHpa), csvFloat(&s.RainMM), csvFloat(s.WindMeanMph), csvFloat(s.WindPrevailingDeg),
+		csvFloat(s.GustMaxMph), gust, csvFloat(s.GustMaxDirectionDeg)}
+}
+
+// observations is the records, or the rollups, between two times
+//
+//	/api/v1/observations?from=&to=&interval=raw|hour|day|month&limit=&format=json|csv
+//
+// from defaults to a day before to, and to to now. A rollup is in if it starts in the range.
+func (s *Server) observations(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := clock.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := s.parseTime(v)
+		if err != nil {
+			badRequest(rw, err)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := s.parseTime(v)
+		if err != nil {
+			badRequest(rw, err)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		badRequest(rw, errors.New("from must be before to"))
+		return
+	}
+	limit, err := pageLimit(r)
+	if err != nil {
+		badRequest(rw, err)
+		return
+	}
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "raw"
+	}
+	// one extra to know if there's another page, and UTC as SQLite compares them as text
+	from, to = from.UTC(), to.UTC()
+	rows := int32(limit + 1)
+	ctx := r.Context()
+	switch interval {
+	case "raw":
+		recs, err := s.db.GetRecordsPage(ctx, postgres.GetRecordsPageParams{FromDate: from, ToDate: to, RowLimit: rows})
+		if err != nil {
+			dbError(rw, err)
+			return
+		}
+		p := page[Observation]{From: from, To: to, Interval: interval}
+		for _, rec := range recs {
+			p.Data = append(p.Data, newObservation(rec))
+		}
+		writePage(rw, r, observationHeader, p, limit)
+	case "hour":
+		recs, err := s.db.GetHourlyPage(ctx, postgres.GetHourlyPageParams{FromDate: from, ToDate: to, RowLimit: rows})
+		s.summaries(rw, r, from, to, interval, recs, err, limit)
+	case "day":
+		recs, err := s.db.GetDailyPage(ctx, postgres.GetDailyPageParams{FromDate: from, ToDate: to, RowLimit: rows})
+		s.summaries(rw, r, from, to, interval, hourly(recs), err, limit)
+	case "month":
+		recs, err := s.db.GetMonthlyPage(ctx, postgres.GetMonthlyPageParams{FromDate: from, ToDate: to, RowLimit: rows})
+		s.summaries(rw, r, from, to, interval, hourly(recs), err, limit)
+	default:
+		badRequest(rw, fmt.Errorf("unknown interval [%v], use raw, hour, day or month", interval))
+	}
+}
+
+// dailySummary is the climatological days (09:00 to 09:00) that start in a month
+//
+//	/api/v1/summary/daily?month=2006-01&format=json|csv
+//
+// month defaults to this month.
+func (s *Server) dailySummary(rw http.ResponseWriter, r *http.Request) {
+	month := clock.Now().In(s.loc)
+	if v := r.URL.Query().Get("month"); v != "" {
+		m, err := time.ParseInLocation("2006-01", v, s.loc)
+		if err != nil {
+			badRequest(rw, fmt.Errorf("unknown month [%v], use 2006-01", v))
+			return
+		}
+		month = m
+	}
+	start := time.Date(month.Year(), month.Month(), 1, rollup.DayStartHour, 0, 0, 0, s.loc)
+	from, to := start.UTC(), rollup.Month.End(start).UTC()
+
+	// a month is never more than a page
+	limit := 31
+	recs, err := s.db.GetDailyPage(r.Context(), postgres.GetDailyPageParams{FromDate: from, ToDate: to, RowLimit: int32(limit + 1)})
+	s.summaries(rw, r, from, to, "day", hourly(recs), err, limit)
+}
+
+func (s *Server) summaries(rw http.ResponseWriter, r *http.Request, from, to time.Time, interval string, recs []postgres.WeatherHourly, err error, limit int) {
+	if err != nil {
+		dbError(rw, err)
+		return
+	}
+	p := page[Summary]{From: from, To: to, Interval: interval}
+	for _, rec := range recs {
+		p.Data = append(p.Data, newSummary(rec))
+	}
+	writePage(rw, r, summaryHeader, p, limit)
+}
+
+// hourly converts daily or monthly rollups, they have the same columns
+func hourly[T postgres.WeatherDaily | postgres.WeatherMonthly](recs []T) []postgres.WeatherHourly {
+	var h []postgres.WeatherHourly
+	for _, r := range recs {
+		h = append(h, postgres.WeatherHourly(r))
+	}
+	return h
+}
@@ -0,0 +1,123 @@
+package aprs
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+/*
+APRS weather reports, for the Citizen Weather Observer Program (CWOP).
+
+http://www.aprs.org/doc/APRS101.PDF chapter 12 and
+http://www.wxqa.com/faq.html
+
+A complete weather report with a position and a timestamp looks like
+
+	CALL>APRS,TCPIP*:@011015z5030.00N/00330.00W_090/005g010t068r010p...P020h50b10029
+
+ @ddhhmmz	day, hour and minute, UTC
+ DDMM.mmN	latitude, / is the primary symbol table
+ DDDMM.mmW	longitude, _ is the weather station symbol
+ ccc/sss	wind direction (degrees) and sustained speed (mph), the c and s fields
+ gggg		gust (mph, peak in the last 5 minutes)
+ tttt		temperature (F, can be negative, -05)
+ rrrr		rain in the last hour (hundredths of an inch)
+ pppp		rain in the last 24 hours (hundredths of an inch)
+ PPPP		rain since midnight (hundredths of an inch)
+ hhh		humidity (%, 00 is 100)
+ bbbbbb		sea level pressure (tenths of a millibar)
+
+c, s, g and t have to be there, ... means no reading. The others are left out
+when there is no reading.
+*/
+
+// Weather is one report, anything nil is missing
+type Weather struct {
+	Time      time.Time
+	Latitude  float64 // decimal degrees, north is positive
+	Longitude float64 // decimal degrees, east is positive
+	WindDir   *float64
+	WindMph   *float64
+	GustMph   *float64
+	TempF     *float64
+	// rain in inches
+	RainHourIn     *float64
+	Rain24HourIn   *float64
+	RainMidnightIn *float64
+	Humidity       *float64
+	PressureHpa    *float64 // sea level
+}
+
+// Packet is the APRS-IS line for w from the station call, without the line ending.
+// The comment goes on the end, CWOP like the software name there.
+func Packet(call string, w Weather, comment string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v>APRS,TCPIP*:@%vz", call, w.Time.UTC().Format("021504"))
+	b.WriteString(position(w.Latitude, 'N', 'S', 2))
+	b.WriteByte('/')
+	b.WriteString(position(w.Longitude, 'E', 'W', 3))
+	b.WriteByte('_')
+
+	dir := w.WindDir
+	if dir != nil && math.Round(*dir) == 0 {
+		// 0 is no direction, north is 360
+		north := 360.0
+		dir = &north
+	}
+	b.WriteString(field("", dir, 1, 3))
+	b.WriteByte('/')
+	b.WriteString(field("", w.WindMph, 1, 3))
+	b.WriteString(field("g", w.GustMph, 1, 3))
+	b.WriteString(field("t", w.TempF, 1, 3))
+	b.WriteString(optional("r", w.RainHourIn, 100, 3))
+	b.WriteString(optional("p", w.Rain24HourIn, 100, 3))
+	b.WriteString(optional("P", w.RainMidnightIn, 100, 3))
+	if w.Humidity != nil {
+		h := int(math.Round(*w.Humidity))
+		h = max(1, min(h, 100))
+		b.WriteString(fmt.Sprintf("h%02d", h%100))
+	}
+	b.WriteString(optional("b", w.PressureHpa, 10, 5))
+	b.WriteString(comment)
+	return b.String()
+}
+
+// Login is the line that logs in to an APRS-IS server, the passcode is -1 for
+// CWOP stations without an amateur radio licence.
+func Login(call, passcode, software, version string) string {
+	return fmt.Sprintf("user %v pass %v vers %v %v", call, passcode, software, version)
+}
+
+// position is degrees and minutes to 2 places, padded to deg digits
+func position(v float64, pos, neg byte, deg int) string {
+	hemi := pos
+	if v < 0 {
+		hemi = neg
+	}
+	// whole hundredths of a minute so the minutes can't round up to 60
+	m := int(math.Round(math.Abs(v) * 6000))
+	return fmt.Sprintf("%0*d%02d.%02d%c", deg, m/6000, (m%6000)/100, m%100, hemi)
+}
+
+// field is v*scale rounded and zero padded to width digits, dots if v is missing
+func field(key string, v *float64, scale float64, width int) string {
+	if v == nil {
+		return key + strings.Repeat(".", width)
+	}
+	n := int(math.Round(*v * scale))
+	// keep it in the width, a negative one has the sign in there too
+	top := int(math.Pow10(width)) - 1
+	bottom := -(int(math.Pow10(width-1)) - 1)
+	n = max(bottom, min(n, top))
+	return fmt.Sprintf("%v%0*d", key, width, n)
+}
+
+// optional is a field that is left out if v is missing
+func optional(key string, v *float64, scale float64, width int) string {
+	if v == nil {
+		return ""
+	}
+	return field(key, v, scale, width)
+}
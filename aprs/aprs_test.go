@@ -0,0 +1,53 @@
+package aprs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ptr is for the optional values in the weather
+func ptr(v float64) *float64 { return &v }
+
+func TestPacket(t *testing.T) {
+	w := Weather{
+		Time:           time.Date(2025, 3, 1, 10, 15, 30, 0, time.UTC),
+		Latitude:       50.5,
+		Longitude:      -3.5,
+		WindDir:        ptr(90.4),
+		WindMph:        ptr(5.2),
+		GustMph:        ptr(10),
+		TempF:          ptr(68),
+		RainHourIn:     ptr(0.1),
+		RainMidnightIn: ptr(0.2),
+		Humidity:       ptr(50),
+		PressureHpa:    ptr(1002.88),
+	}
+	require.Equal(t, "TEST>APRS,TCPIP*:@011015z5030.00N/00330.00W_090/005g010t068r010P020h50b10029", Packet("TEST", w, ""))
+
+	// nothing but the position, the wind and temperature always have a place
+	w = Weather{Time: w.Time, Latitude: -33.8688, Longitude: 151.2093}
+	require.Equal(t, "TEST>APRS,TCPIP*:@011015z3352.13S/15112.56E_.../...g...t....test", Packet("TEST", w, ".test"))
+
+	w.TempF = ptr(-5.4)
+	w.Humidity = ptr(100)
+	w.WindDir = ptr(0.2)
+	require.Equal(t, "TEST>APRS,TCPIP*:@011015z3352.13S/15112.56E_360/...g...t-05h00", Packet("TEST", w, ""))
+
+	// out of range is clamped rather than breaking the packet
+	w.TempF = ptr(-150)
+	w.Humidity = ptr(0)
+	require.Contains(t, Packet("TEST", w, ""), "t-99h01")
+}
+
+func TestPosition(t *testing.T) {
+	require.Equal(t, "5030.00N", position(50.5, 'N', 'S', 2))
+	// 59.999 minutes rounds up to the next degree
+	require.Equal(t, "05100.00N", position(50.99999, 'N', 'S', 3))
+	require.Equal(t, "00000.00E", position(0, 'E', 'W', 3))
+}
+
+func TestLogin(t *testing.T) {
+	require.Equal(t, "user TEST pass -1 vers weather 2.2.0", Login("TEST", "-1", "weather", "2.2.0"))
+}
@@ -154,6 +154,20 @@ func (b *SampleBuffer) GetRawData() ([]float64, Size, Position) {
 	return copy, Size(b.size), Position(b.position)
 }
 
+// Last is a copy of the last n items, oldest first
+func (b *SampleBuffer) Last(n int) []float64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if n > b.size {
+		n = b.size
+	}
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = b.data[(b.position-n+i+b.size)%b.size]
+	}
+	return out
+}
+
 func (b *SampleBuffer) GetSize() int {
 	return b.size
 }
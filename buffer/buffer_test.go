@@ -93,3 +93,16 @@ func TestAverageLast(t *testing.T) {
 	a = buf.AverageLast(10)
 	assert.Equal(t, Average(2.2), a)
 }
+
+func TestLast(t *testing.T) {
+	buf := NewBuffer(4)
+	buf.AddItem(1)
+	buf.AddItem(2)
+	buf.AddItem(3)
+
+	assert.Equal(t, []float64{2, 3}, buf.Last(2))
+	// round the end, and no more than it holds
+	buf.AddItem(4)
+	buf.AddItem(5)
+	assert.Equal(t, []float64{2, 3, 4, 5}, buf.Last(10))
+}
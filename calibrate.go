@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/sensors"
+	logger "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const calibrateSamples = 20
+
+// calibrateVane walks round the compass points reading the vane volts at each one
+// and writes out a vane table to paste into the config file. args are what
+// comes after calibrate-vane on the command line.
+//
+//	weather calibrate-vane -out vane.yaml
+func calibrateVane(cfg *env.Config, args []string) error {
+	fs := flag.NewFlagSet("calibrate-vane", flag.ContinueOnError)
+	outFile := fs.String("out", "", "writes the vane table to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	// only the vane is needed, not the masthead pulse counter
+	var vaneReader sensors.VaneReader
+	if cfg.Flags.Sim {
+		cfg.Sensors.Wind.Enabled = true
+		vaneReader = sensors.SimulatedHardware(cfg).Vane
+	} else {
+		v, closer, err := sensors.OpenVane(cfg)
+		if err != nil {
+			return fmt.Errorf("no wind vane found [%w]", err)
+		}
+		defer closer.Close()
+		vaneReader = v
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	// the points are where the vane really pointed, so any mast offset is
+	// already in them and the table goes out with none
+	vane := env.Vane{}
+	for i, name := range sensors.CompassPoints {
+		deg := float64(i) * 22.5
+		fmt.Fprintf(os.Stderr, "Point the vane %v (%v°) and press enter ", name, deg)
+		if _, err := in.ReadString('\n'); err != nil {
+			return err
+		}
+		sum, lo, hi := 0.0, math.Inf(1), math.Inf(-1)
+		for n := 0; n < calibrateSamples; n++ {
+			v, err := vaneReader.ReadVolts()
+			if err != nil {
+				return err
+			}
+			sum += v
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+			time.Sleep(50 * time.Millisecond)
+		}
+		volts := math.Round(sum/calibrateSamples*1000) / 1000
+		fmt.Fprintf(os.Stderr, "%.3fV\n", volts)
+		if hi-lo > 0.1 {
+			logger.Warnf("Vane moved while reading %v [%.3fV - %.3fV], might want to do it again", name, lo, hi)
+		}
+		vane.Table = append(vane.Table, env.VanePoint{Degrees: deg, Volts: volts})
+	}
+	if _, err := vane.Points(); err != nil {
+		return err
+	}
+
+	out := map[string]interface{}{
+		"sensors": map[string]interface{}{
+			"wind": map[string]interface{}{
+				"vane": vane,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) // same as weather.example.yaml
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if *outFile == "" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	logger.Infof("Writing vane table to [%v]", *outFile)
+	return os.WriteFile(*outFile, b, 0644)
+}
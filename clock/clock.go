@@ -0,0 +1,83 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The station normally runs in real time. When replaying a recording it can run
+// faster than real time and Now() reports the time in the recording, so all the
+// tickers and timestamps have to come from here rather than the time package.
+
+var (
+	lock   sync.RWMutex
+	speed  = 1.0
+	origin time.Time // recording time when the replay started
+	start  time.Time // wall time when the replay started
+)
+
+// Replay starts the clock at from, running at speed times real time.
+func Replay(from time.Time, s float64) {
+	lock.Lock()
+	defer lock.Unlock()
+	if s <= 0 {
+		s = 1
+	}
+	speed = s
+	origin = from
+	start = time.Now()
+}
+
+// Now returns the current time, or the time in the recording when replaying.
+func Now() time.Time {
+	lock.RLock()
+	defer lock.RUnlock()
+	if origin.IsZero() {
+		return time.Now()
+	}
+	return origin.Add(time.Duration(float64(time.Since(start)) * speed))
+}
+
+// Replaying is true when the clock is running from a recording.
+func Replaying() bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	return !origin.IsZero()
+}
+
+// Speed returns how many times faster than real time the clock is running.
+func Speed() float64 {
+	lock.RLock()
+	defer lock.RUnlock()
+	return speed
+}
+
+// Scale converts a clock duration into a real duration.
+func Scale(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / Speed())
+}
+
+// Tick is time.Tick for the clock, the channel gets the clock time every d. It
+// is closed when ctx is done, so a for range over it stops on shutdown.
+func Tick(ctx context.Context, d time.Duration) <-chan time.Time {
+	c := make(chan time.Time)
+	go func() {
+		defer close(c)
+		t := time.NewTicker(Scale(d))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case c <- Now():
+			}
+		}
+	}()
+	return c
+}
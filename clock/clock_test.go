@@ -0,0 +1,24 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTick(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := Tick(ctx, time.Millisecond)
+	<-c
+	<-c
+	cancel()
+
+	// the channel is closed once ctx is done, so for range ends
+	n := 0
+	for range c {
+		n++
+	}
+	require.LessOrEqual(t, n, 1)
+}
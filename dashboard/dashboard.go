@@ -0,0 +1,26 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+/*
+A small web page for the current weather, for anyone on the network without a
+login to grafana. It's built into the binary and only uses the api, the
+history comes from /api/v1/observations and then it follows /api/v1/stream.
+*/
+
+//go:embed static
+var static embed.FS
+
+// Register serves the dashboard at /dashboard/
+func Register(mux *http.ServeMux) {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// can only happen if the embed above is wrong
+		panic(err)
+	}
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.FS(files))))
+}
@@ -0,0 +1,32 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, url, nil))
+		return rw
+	}
+
+	rw := get("/dashboard/")
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Contains(t, rw.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rw.Body.String(), `<script src="app.js">`)
+
+	for _, f := range []string{"app.js", "style.css"} {
+		require.Equal(t, http.StatusOK, get("/dashboard/"+f).Code, f)
+	}
+	require.Equal(t, http.StatusNotFound, get("/dashboard/nothing.js").Code)
+	// without the slash
+	require.Equal(t, "/dashboard/", get("/dashboard").Header().Get("Location"))
+}
@@ -0,0 +1,182 @@
+// The dashboard, it gets the last 24 hours from the api then follows the live
+// stream. Paths are relative so it still works behind a proxy.
+
+const api = "../api/v1/";
+const day = 24 * 60 * 60 * 1000;
+const mphToKmh = 1.609344;
+// older than this and the station has probably stopped
+const staleAfter = 5 * 60 * 1000;
+
+const sparks = ["temperature", "humidity", "mslp", "wind_speed", "rain_rate"];
+const points = [];
+let lastUpdate = 0;
+
+const $ = id => document.getElementById(id);
+
+function fmt(v, places = 1) {
+  return v === null || v === undefined ? "–" : v.toFixed(places);
+}
+
+// the readings from an event, value or null
+function values(readings) {
+  const out = {};
+  for (const [name, r] of Object.entries(readings)) {
+    out[name] = r.value;
+  }
+  return out;
+}
+
+const compass = ["N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"];
+
+function point(deg) {
+  return compass[Math.round(deg / 22.5) % 16];
+}
+
+function turn(id, deg) {
+  if (deg !== null && deg !== undefined) {
+    $(id).setAttribute("transform", `rotate(${deg})`);
+  }
+}
+
+function showWind(v) {
+  if ("wind_speed" in v) $("wind_speed").textContent = fmt(v.wind_speed);
+  if ("wind_gust" in v) $("wind_gust").textContent = fmt(v.wind_gust);
+  if (v.wind_direction !== undefined) {
+    $("wind_dir").textContent = v.wind_direction === null ? "" : point(v.wind_direction);
+    turn("arrow", v.wind_direction);
+  }
+  turn("gust-arrow", v.wind_gust_direction);
+}
+
+function showRain(v) {
+  if ("rain_day" in v) $("rain_day").textContent = fmt(v.rain_day);
+  if ("rain_rate" in v) $("rain_rate").textContent = fmt(v.rain_rate);
+}
+
+function showHealth(c) {
+  $("sensors").innerHTML = Object.entries(c.sensors || {})
+    .map(([name, on]) => `<li class="${on ? "good" : "off"}">${name} <small>${on ? "on" : "off"}</small></li>`)
+    .join("");
+  // only the readings that aren't good, there's usually nothing to say
+  const problems = Object.entries(c.readings)
+    .filter(([, r]) => r.quality !== "good")
+    .map(([name, r]) => `<li class="${r.quality}">${name.replace(/_/g, " ")} <small>${r.quality}${r.reason ? ", " + r.reason : ""}</small></li>`);
+  $("quality").innerHTML = problems.length ? problems.join("") : `<li class="good">all readings good</li>`;
+}
+
+function showConditions(c) {
+  $("station").textContent = c.station.id;
+  const v = values(c.readings);
+  $("temperature").textContent = fmt(v.temperature);
+  $("humidity").textContent = fmt(v.humidity, 0);
+  $("dew_point").textContent = fmt(v.dew_point);
+  $("mslp").textContent = fmt(v.mslp);
+  showWind(v);
+  showRain(v);
+  showHealth(c);
+  addPoint(new Date(c.time), v);
+  seen(c.time);
+}
+
+function seen(t) {
+  lastUpdate = Math.max(lastUpdate, new Date(t).getTime());
+  checkStale();
+}
+
+function checkStale() {
+  const u = $("updated");
+  if (!lastUpdate) return;
+  const age = Date.now() - lastUpdate;
+  u.textContent = "updated " + new Date(lastUpdate).toLocaleTimeString();
+  u.classList.toggle("stale", age > staleAfter);
+}
+
+function addPoint(t, v) {
+  const p = { t: t.getTime() };
+  for (const name of sparks) p[name] = v[name];
+  points.push(p);
+  const from = Date.now() - day;
+  while (points.length && points[0].t < from) points.shift();
+  drawSparks();
+}
+
+function drawSparks() {
+  const to = Date.now();
+  const from = to - day;
+  for (const name of sparks) {
+    const svg = $("spark-" + name);
+    const ps = points.filter(p => p[name] !== null && p[name] !== undefined);
+    const label = svg.nextElementSibling;
+    if (!ps.length) {
+      svg.innerHTML = "";
+      label.textContent = "";
+      continue;
+    }
+    let lo = Math.min(...ps.map(p => p[name]));
+    let hi = Math.max(...ps.map(p => p[name]));
+    if (hi - lo < 1e-6) {
+      lo -= 1;
+      hi += 1;
+    }
+    // draw in a 1000x100 box and let the svg stretch it
+    const xy = ps.map(p => `${((p.t - from) / day * 1000).toFixed(1)},${(100 - (p[name] - lo) / (hi - lo) * 100).toFixed(1)}`);
+    svg.setAttribute("viewBox", "0 -2 1000 104");
+    svg.setAttribute("preserveAspectRatio", "none");
+    svg.innerHTML = `<polyline points="${xy.join(" ")}"/>`;
+    label.textContent = `${fmt(lo)}–${fmt(hi)}`;
+  }
+}
+
+// the history from the db, in the api's units (the wind is mph)
+async function loadHistory() {
+  const r = await fetch(api + "observations?interval=raw&limit=10000");
+  if (!r.ok) return;
+  const page = await r.json();
+  for (const o of page.data) {
+    points.push({
+      t: new Date(o.time).getTime(),
+      temperature: o.temperature_c,
+      humidity: o.humidity_pct,
+      mslp: o.mslp_hpa,
+      wind_speed: o.wind_speed_mph === null ? null : o.wind_speed_mph * mphToKmh,
+      rain_rate: o.rain_rate_mm_hr,
+    });
+  }
+  points.sort((a, b) => a.t - b.t);
+  drawSparks();
+}
+
+async function loadCurrent() {
+  const r = await fetch(api + "current?units=metric");
+  if (r.ok) showConditions(await r.json());
+}
+
+function follow() {
+  const live = new EventSource(api + "stream");
+  live.addEventListener("observation", e => showConditions(JSON.parse(e.data)));
+  live.addEventListener("rain", e => {
+    const c = JSON.parse(e.data);
+    showRain(values(c.readings));
+    seen(c.time);
+  });
+  live.addEventListener("gust", e => {
+    const c = JSON.parse(e.data);
+    showWind(values(c.readings));
+    seen(c.time);
+  });
+}
+
+function drawTicks() {
+  let ticks = "";
+  for (let i = 0; i < 16; i++) {
+    const len = i % 4 === 0 ? 12 : 6;
+    ticks += `<line y1="-100" y2="${-100 + len}" transform="rotate(${i * 22.5})"/>`;
+  }
+  $("ticks").innerHTML = ticks;
+}
+
+drawTicks();
+loadHistory().catch(() => {}).finally(() => loadCurrent().catch(() => {}));
+follow();
+setInterval(checkStale, 10000);
+setInterval(drawSparks, 60000);
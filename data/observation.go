@@ -0,0 +1,86 @@
+package data
+
+import "time"
+
+// Quality is the QC flag on a reading. Good and Suspect readings are published,
+// Bad and Missing ones are held back.
+type Quality uint8
+
+const (
+	Good    Quality = iota
+	Suspect         // passed the range check but something looks off, eg stuck
+	Bad             // out of range or a spike
+	Missing         // the sensor didn't give a reading
+)
+
+func (q Quality) String() string {
+	switch q {
+	case Good:
+		return "good"
+	case Suspect:
+		return "suspect"
+	case Bad:
+		return "bad"
+	default:
+		return "missing"
+	}
+}
+
+// Reading is one value with its QC flag, Reason says which check failed.
+type Reading struct {
+	Value   float64
+	Quality Quality
+	Reason  string
+}
+
+// Value is a reading that hasn't been checked yet
+func Value(v float64) Reading {
+	return Reading{Value: v}
+}
+
+// NoValue is a reading we couldn't get
+func NoValue(reason string) Reading {
+	return Reading{Quality: Missing, Reason: reason}
+}
+
+// Usable is true if the reading can be published
+func (r Reading) Usable() bool {
+	return r.Quality == Good || r.Quality == Suspect
+}
+
+// Flag marks the reading if q is worse than what it already has
+func (r *Reading) Flag(q Quality, reason string) {
+	if q > r.Quality {
+		r.Quality = q
+		r.Reason = reason
+	}
+}
+
+// Observation is one reading of all the sensors.
+type Observation struct {
+	Time         time.Time // when the sensors were read
+	TemperatureC Reading
+	Humidity     Reading
+	PressureHpa  Reading // at the station, not sea level
+	RainMM       Reading // since the last observation
+	RainRate     Reading // mm/hr
+	WindSpeed    Reading // mph, 10 minute mean
+	WindDir      Reading // degrees, 10 minute mean
+	WindGust     Reading // mph
+	WindGustDir  Reading // degrees
+}
+
+// Readings names each reading, for the QC checks and logging
+func (o *Observation) Readings() map[string]*Reading {
+	return map[string]*Reading{
+		"temperature":    &o.TemperatureC,
+		"humidity":       &o.Humidity,
+		"pressure":       &o.PressureHpa,
+		"rain":           &o.RainMM,
+		"rain_rate":      &o.RainRate,
+		"wind_speed":     &o.WindSpeed,
+		"wind_direction": &o.WindDir,
+		"wind_gust":      &o.WindGust,
+		"wind_gust_dir":  &o.WindGustDir,
+	}
+}
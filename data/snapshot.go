@@ -0,0 +1,42 @@
+package data
+
+import "sync"
+
+// Snapshot is the sensors read once, after QC, with what is worked out from
+// them. One loop reads the sensors, everything that reports the weather (the
+// web server, MQTT, prometheus, the db and WOW) uses the latest snapshot so they
+// all agree and web requests don't touch the I2C bus.
+type Snapshot struct {
+	Observation // Time is when the sensors were read
+	DewPointC   *float64
+	MSLPHpa     *float64
+	RainDayMM   *float64
+	// the wind now (2 minute means), the observation has the 10 minute means
+	WindSpeedNow Reading // mph
+	WindDirNow   Reading // degrees
+	WindDirSD    Reading // degrees
+	// which sensors are switched on
+	Sensors map[string]bool
+}
+
+// Latest holds the newest snapshot, it's safe to use from any goroutine
+type Latest struct {
+	lock sync.RWMutex
+	snap *Snapshot
+}
+
+func (l *Latest) Set(s Snapshot) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.snap = &s
+}
+
+// Get is the newest snapshot, false until there is one
+func (l *Latest) Get() (Snapshot, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.snap == nil {
+		return Snapshot{}, false
+	}
+	return *l.snap, true
+}
@@ -0,0 +1,243 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is one numbered file, 0002_derived_values.sql. The file has a
+// "-- +migrate Up" section and a "-- +migrate Down" section to undo it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, Applied is zero if it hasn't been
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+// ErrWrongVersion is returned by Check if the db needs migrating (or the code is too old)
+var ErrWrongVersion = errors.New("wrong db schema version")
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+var marker = regexp.MustCompile(`(?mi)^--\s*\+migrate\s+(up|down)\s*$`)
+
+// Load reads the migrations in dir of fsys, sorted by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %v and %v have the same version", other, e.Name())
+		}
+		seen[version] = e.Name()
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, err := parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", e.Name(), err)
+		}
+		mig.Version = version
+		mig.Name = m[2]
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func parse(sql string) (Migration, error) {
+	m := Migration{}
+	locs := marker.FindAllStringSubmatchIndex(sql, -1)
+	for i, loc := range locs {
+		end := len(sql)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := strings.TrimSpace(sql[loc[1]:end])
+		switch strings.ToLower(sql[loc[2]:loc[3]]) {
+		case "up":
+			m.Up = body
+		case "down":
+			m.Down = body
+		}
+	}
+	if m.Up == "" {
+		return m, fmt.Errorf("no -- +migrate Up section")
+	}
+	return m, nil
+}
+
+// Migrator applies migrations to a db and keeps track of them in schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Latest is the version the code expects
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// Version is the highest migration applied to the db
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// Status lists every migration, plus any in the db this code doesn't know about
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var status []Status
+	for _, mig := range m.migrations {
+		status = append(status, Status{Migration: mig, Applied: applied[mig.Version]})
+		delete(applied, mig.Version)
+	}
+	for v, at := range applied {
+		status = append(status, Status{Migration: Migration{Version: v, Name: "unknown"}, Applied: at})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+// Up applies every migration that hasn't been, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := m.tx(ctx, mig.Up, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+			mig.Version, mig.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migration %v %v: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down undoes the latest applied migration, nil if there wasn't one.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	version, err := m.Version(ctx)
+	if err != nil || version == 0 {
+		return nil, err
+	}
+	for _, mig := range m.migrations {
+		if mig.Version != version {
+			continue
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("migration %v %v can't be undone", mig.Version, mig.Name)
+		}
+		if err := m.tx(ctx, mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+			return nil, fmt.Errorf("migration %v %v: %w", mig.Version, mig.Name, err)
+		}
+		return &mig, nil
+	}
+	return nil, fmt.Errorf("the db is at version %v, this code only knows up to %v", version, m.Latest())
+}
+
+func (m *Migrator) tx(ctx context.Context, script string, record string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Check returns an error if the db isn't at the version the code expects
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version < m.Latest():
+		return fmt.Errorf("%w: db is version %v, needs %v, run: weather migrate up", ErrWrongVersion, version, m.Latest())
+	case version > m.Latest():
+		return fmt.Errorf("%w: db is version %v, newer than this build (%v)", ErrWrongVersion, version, m.Latest())
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.sql": {Data: []byte("-- +migrate Up\nALTER TABLE a ADD COLUMN b INT;\n\n-- +migrate Down\nALTER TABLE a DROP COLUMN b;\n")},
+		"m/0001_first.sql":  {Data: []byte("-- +migrate up\nCREATE TABLE a (id INT);\n")},
+		"m/README":          {Data: []byte("not a migration")},
+	}
+	migrations, err := Load(fsys, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, 1, migrations[0].Version)
+	require.Equal(t, "first", migrations[0].Name)
+	require.Equal(t, "CREATE TABLE a (id INT);", migrations[0].Up)
+	require.Equal(t, "", migrations[0].Down)
+	require.Equal(t, "ALTER TABLE a ADD COLUMN b INT;", migrations[1].Up)
+	require.Equal(t, "ALTER TABLE a DROP COLUMN b;", migrations[1].Down)
+	require.Equal(t, 2, New(nil, migrations).Latest())
+
+	fsys["m/0002_again.sql"] = &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 1;\n")}
+	_, err = Load(fsys, "m")
+	require.Error(t, err)
+}
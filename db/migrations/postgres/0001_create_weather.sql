@@ -1,4 +1,4 @@
--- +migrate up
+-- +migrate Up
 
 CREATE TABLE IF NOT EXISTS weather (
     record_date TIMESTAMP without time zone PRIMARY KEY,
@@ -10,3 +10,6 @@ CREATE TABLE IF NOT EXISTS weather (
     wind_direction FLOAT NOT NULL
 );
 
+-- +migrate Down
+
+DROP TABLE weather;
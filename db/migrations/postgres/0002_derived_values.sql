@@ -0,0 +1,41 @@
+-- +migrate Up
+
+-- humidity and the values worked out from the readings, null if they failed QC
+ALTER TABLE weather
+    ADD COLUMN humidity FLOAT,
+    ADD COLUMN dew_point FLOAT,
+    ADD COLUMN mslp FLOAT,
+    ADD COLUMN rain_rate FLOAT,
+    ADD COLUMN wind_gust_direction FLOAT;
+
+-- so one bad sensor doesn't lose the whole record
+ALTER TABLE weather
+    ALTER COLUMN temperature DROP NOT NULL,
+    ALTER COLUMN pressure DROP NOT NULL,
+    ALTER COLUMN wind_speed DROP NOT NULL,
+    ALTER COLUMN wind_gust DROP NOT NULL,
+    ALTER COLUMN wind_direction DROP NOT NULL;
+
+-- +migrate Down
+
+-- records with a missing reading can't go back in the old table
+DELETE FROM weather
+WHERE temperature IS NULL
+    OR pressure IS NULL
+    OR wind_speed IS NULL
+    OR wind_gust IS NULL
+    OR wind_direction IS NULL;
+
+ALTER TABLE weather
+    ALTER COLUMN temperature SET NOT NULL,
+    ALTER COLUMN pressure SET NOT NULL,
+    ALTER COLUMN wind_speed SET NOT NULL,
+    ALTER COLUMN wind_gust SET NOT NULL,
+    ALTER COLUMN wind_direction SET NOT NULL;
+
+ALTER TABLE weather
+    DROP COLUMN humidity,
+    DROP COLUMN dew_point,
+    DROP COLUMN mslp,
+    DROP COLUMN rain_rate,
+    DROP COLUMN wind_gust_direction;
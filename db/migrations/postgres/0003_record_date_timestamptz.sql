@@ -0,0 +1,13 @@
+-- +migrate Up
+
+-- record_date used to be now() on the db server, so the old values are in the
+-- server's time zone. From now on it's the time the sensors were read.
+ALTER TABLE weather
+    ALTER COLUMN record_date TYPE TIMESTAMP with time zone
+    USING record_date AT TIME ZONE current_setting('TimeZone');
+
+-- +migrate Down
+
+ALTER TABLE weather
+    ALTER COLUMN record_date TYPE TIMESTAMP without time zone
+    USING record_date AT TIME ZONE current_setting('TimeZone');
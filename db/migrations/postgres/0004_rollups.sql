@@ -0,0 +1,65 @@
+-- +migrate Up
+
+-- summaries of the weather table kept up to date by the rollup package, so
+-- nothing has to read years of records. A period covers the records after
+-- period_start up to and including the end, the day is 09:00 to 09:00 like the
+-- rain and a month is the days that start in it.
+CREATE TABLE weather_hourly (
+    period_start TIMESTAMPTZ PRIMARY KEY,
+    samples INTEGER NOT NULL,
+    temp_min FLOAT,
+    temp_max FLOAT,
+    temp_mean FLOAT,
+    pressure_min FLOAT,
+    pressure_max FLOAT,
+    mslp_min FLOAT,
+    mslp_max FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_mean FLOAT,
+    wind_prevailing FLOAT,
+    gust_max FLOAT,
+    gust_time TIMESTAMPTZ,
+    gust_direction FLOAT
+);
+
+CREATE TABLE weather_daily (
+    period_start TIMESTAMPTZ PRIMARY KEY,
+    samples INTEGER NOT NULL,
+    temp_min FLOAT,
+    temp_max FLOAT,
+    temp_mean FLOAT,
+    pressure_min FLOAT,
+    pressure_max FLOAT,
+    mslp_min FLOAT,
+    mslp_max FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_mean FLOAT,
+    wind_prevailing FLOAT,
+    gust_max FLOAT,
+    gust_time TIMESTAMPTZ,
+    gust_direction FLOAT
+);
+
+CREATE TABLE weather_monthly (
+    period_start TIMESTAMPTZ PRIMARY KEY,
+    samples INTEGER NOT NULL,
+    temp_min FLOAT,
+    temp_max FLOAT,
+    temp_mean FLOAT,
+    pressure_min FLOAT,
+    pressure_max FLOAT,
+    mslp_min FLOAT,
+    mslp_max FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_mean FLOAT,
+    wind_prevailing FLOAT,
+    gust_max FLOAT,
+    gust_time TIMESTAMPTZ,
+    gust_direction FLOAT
+);
+
+-- +migrate Down
+
+DROP TABLE weather_monthly;
+DROP TABLE weather_daily;
+DROP TABLE weather_hourly;
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+-- the same table as postgres/0001 to 0003, there were no SQLite stations before them
+CREATE TABLE IF NOT EXISTS weather (
+    record_date TIMESTAMP PRIMARY KEY,
+    temperature FLOAT,
+    pressure FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_speed FLOAT,
+    wind_gust FLOAT,
+    wind_direction FLOAT,
+    humidity FLOAT,
+    dew_point FLOAT,
+    mslp FLOAT,
+    rain_rate FLOAT,
+    wind_gust_direction FLOAT
+);
+
+-- +migrate Down
+
+DROP TABLE weather;
@@ -0,0 +1,62 @@
+-- +migrate Up
+
+-- the same as postgres/0004
+CREATE TABLE weather_hourly (
+    period_start TIMESTAMP PRIMARY KEY,
+    samples INTEGER NOT NULL,
+    temp_min FLOAT,
+    temp_max FLOAT,
+    temp_mean FLOAT,
+    pressure_min FLOAT,
+    pressure_max FLOAT,
+    mslp_min FLOAT,
+    mslp_max FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_mean FLOAT,
+    wind_prevailing FLOAT,
+    gust_max FLOAT,
+    gust_time TIMESTAMP,
+    gust_direction FLOAT
+);
+
+CREATE TABLE weather_daily (
+    period_start TIMESTAMP PRIMARY KEY,
+    samples INTEGER NOT NULL,
+    temp_min FLOAT,
+    temp_max FLOAT,
+    temp_mean FLOAT,
+    pressure_min FLOAT,
+    pressure_max FLOAT,
+    mslp_min FLOAT,
+    mslp_max FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_mean FLOAT,
+    wind_prevailing FLOAT,
+    gust_max FLOAT,
+    gust_time TIMESTAMP,
+    gust_direction FLOAT
+);
+
+CREATE TABLE weather_monthly (
+    period_start TIMESTAMP PRIMARY KEY,
+    samples INTEGER NOT NULL,
+    temp_min FLOAT,
+    temp_max FLOAT,
+    temp_mean FLOAT,
+    pressure_min FLOAT,
+    pressure_max FLOAT,
+    mslp_min FLOAT,
+    mslp_max FLOAT,
+    rain_mm FLOAT NOT NULL,
+    wind_mean FLOAT,
+    wind_prevailing FLOAT,
+    gust_max FLOAT,
+    gust_time TIMESTAMP,
+    gust_direction FLOAT
+);
+
+-- +migrate Down
+
+DROP TABLE weather_monthly;
+DROP TABLE weather_daily;
+DROP TABLE weather_hourly;
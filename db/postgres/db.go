@@ -27,6 +27,33 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.getAllRecordsStmt, err = db.PrepareContext(ctx, getAllRecords); err != nil {
 		return nil, fmt.Errorf("error preparing query GetAllRecords: %w", err)
 	}
+	if q.getDailyPageStmt, err = db.PrepareContext(ctx, getDailyPage); err != nil {
+		return nil, fmt.Errorf("error preparing query GetDailyPage: %w", err)
+	}
+	if q.getFirstRecordDateStmt, err = db.PrepareContext(ctx, getFirstRecordDate); err != nil {
+		return nil, fmt.Errorf("error preparing query GetFirstRecordDate: %w", err)
+	}
+	if q.getHourlyPageStmt, err = db.PrepareContext(ctx, getHourlyPage); err != nil {
+		return nil, fmt.Errorf("error preparing query GetHourlyPage: %w", err)
+	}
+	if q.getMonthlyPageStmt, err = db.PrepareContext(ctx, getMonthlyPage); err != nil {
+		return nil, fmt.Errorf("error preparing query GetMonthlyPage: %w", err)
+	}
+	if q.getRecordsBetweenStmt, err = db.PrepareContext(ctx, getRecordsBetween); err != nil {
+		return nil, fmt.Errorf("error preparing query GetRecordsBetween: %w", err)
+	}
+	if q.getRecordsPageStmt, err = db.PrepareContext(ctx, getRecordsPage); err != nil {
+		return nil, fmt.Errorf("error preparing query GetRecordsPage: %w", err)
+	}
+	if q.upsertDailyStmt, err = db.PrepareContext(ctx, upsertDaily); err != nil {
+		return nil, fmt.Errorf("error preparing query UpsertDaily: %w", err)
+	}
+	if q.upsertHourlyStmt, err = db.PrepareContext(ctx, upsertHourly); err != nil {
+		return nil, fmt.Errorf("error preparing query UpsertHourly: %w", err)
+	}
+	if q.upsertMonthlyStmt, err = db.PrepareContext(ctx, upsertMonthly); err != nil {
+		return nil, fmt.Errorf("error preparing query UpsertMonthly: %w", err)
+	}
 	if q.writeRecordStmt, err = db.PrepareContext(ctx, writeRecord); err != nil {
 		return nil, fmt.Errorf("error preparing query WriteRecord: %w", err)
 	}
@@ -40,6 +67,51 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing getAllRecordsStmt: %w", cerr)
 		}
 	}
+	if q.getDailyPageStmt != nil {
+		if cerr := q.getDailyPageStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getDailyPageStmt: %w", cerr)
+		}
+	}
+	if q.getFirstRecordDateStmt != nil {
+		if cerr := q.getFirstRecordDateStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getFirstRecordDateStmt: %w", cerr)
+		}
+	}
+	if q.getHourlyPageStmt != nil {
+		if cerr := q.getHourlyPageStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getHourlyPageStmt: %w", cerr)
+		}
+	}
+	if q.getMonthlyPageStmt != nil {
+		if cerr := q.getMonthlyPageStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getMonthlyPageStmt: %w", cerr)
+		}
+	}
+	if q.getRecordsBetweenStmt != nil {
+		if cerr := q.getRecordsBetweenStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getRecordsBetweenStmt: %w", cerr)
+		}
+	}
+	if q.getRecordsPageStmt != nil {
+		if cerr := q.getRecordsPageStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getRecordsPageStmt: %w", cerr)
+		}
+	}
+	if q.upsertDailyStmt != nil {
+		if cerr := q.upsertDailyStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing upsertDailyStmt: %w", cerr)
+		}
+	}
+	if q.upsertHourlyStmt != nil {
+		if cerr := q.upsertHourlyStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing upsertHourlyStmt: %w", cerr)
+		}
+	}
+	if q.upsertMonthlyStmt != nil {
+		if cerr := q.upsertMonthlyStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing upsertMonthlyStmt: %w", cerr)
+		}
+	}
 	if q.writeRecordStmt != nil {
 		if cerr := q.writeRecordStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing writeRecordStmt: %w", cerr)
@@ -82,17 +154,35 @@ func (q *Queries) queryRow(ctx context.Context, stmt *sql.Stmt, query string, ar
 }
 
 type Queries struct {
-	db                DBTX
-	tx                *sql.Tx
-	getAllRecordsStmt *sql.Stmt
-	writeRecordStmt   *sql.Stmt
+	db                     DBTX
+	tx                     *sql.Tx
+	getAllRecordsStmt      *sql.Stmt
+	getDailyPageStmt       *sql.Stmt
+	getFirstRecordDateStmt *sql.Stmt
+	getHourlyPageStmt      *sql.Stmt
+	getMonthlyPageStmt     *sql.Stmt
+	getRecordsBetweenStmt  *sql.Stmt
+	getRecordsPageStmt     *sql.Stmt
+	upsertDailyStmt        *sql.Stmt
+	upsertHourlyStmt       *sql.Stmt
+	upsertMonthlyStmt      *sql.Stmt
+	writeRecordStmt        *sql.Stmt
 }
 
 func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 	return &Queries{
-		db:                tx,
-		tx:                tx,
-		getAllRecordsStmt: q.getAllRecordsStmt,
-		writeRecordStmt:   q.writeRecordStmt,
+		db:                     tx,
+		tx:                     tx,
+		getAllRecordsStmt:      q.getAllRecordsStmt,
+		getDailyPageStmt:       q.getDailyPageStmt,
+		getFirstRecordDateStmt: q.getFirstRecordDateStmt,
+		getHourlyPageStmt:      q.getHourlyPageStmt,
+		getMonthlyPageStmt:     q.getMonthlyPageStmt,
+		getRecordsBetweenStmt:  q.getRecordsBetweenStmt,
+		getRecordsPageStmt:     q.getRecordsPageStmt,
+		upsertDailyStmt:        q.upsertDailyStmt,
+		upsertHourlyStmt:       q.upsertHourlyStmt,
+		upsertMonthlyStmt:      q.upsertMonthlyStmt,
+		writeRecordStmt:        q.writeRecordStmt,
 	}
 }
@@ -5,15 +5,75 @@
 package postgres
 
 import (
+	"database/sql"
 	"time"
 )
 
 type Weather struct {
-	RecordDate    time.Time `json:"record_date"`
-	Temperature   float64   `json:"temperature"`
-	Pressure      float64   `json:"pressure"`
-	RainMm        float64   `json:"rain_mm"`
-	WindSpeed     float64   `json:"wind_speed"`
-	WindGust      float64   `json:"wind_gust"`
-	WindDirection float64   `json:"wind_direction"`
+	RecordDate        time.Time       `json:"record_date"`
+	Temperature       sql.NullFloat64 `json:"temperature"`
+	Pressure          sql.NullFloat64 `json:"pressure"`
+	RainMm            float64         `json:"rain_mm"`
+	WindSpeed         sql.NullFloat64 `json:"wind_speed"`
+	WindGust          sql.NullFloat64 `json:"wind_gust"`
+	WindDirection     sql.NullFloat64 `json:"wind_direction"`
+	Humidity          sql.NullFloat64 `json:"humidity"`
+	DewPoint          sql.NullFloat64 `json:"dew_point"`
+	Mslp              sql.NullFloat64 `json:"mslp"`
+	RainRate          sql.NullFloat64 `json:"rain_rate"`
+	WindGustDirection sql.NullFloat64 `json:"wind_gust_direction"`
+}
+
+type WeatherDaily struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	Samples        int32           `json:"samples"`
+	TempMin        sql.NullFloat64 `json:"temp_min"`
+	TempMax        sql.NullFloat64 `json:"temp_max"`
+	TempMean       sql.NullFloat64 `json:"temp_mean"`
+	PressureMin    sql.NullFloat64 `json:"pressure_min"`
+	PressureMax    sql.NullFloat64 `json:"pressure_max"`
+	MslpMin        sql.NullFloat64 `json:"mslp_min"`
+	MslpMax        sql.NullFloat64 `json:"mslp_max"`
+	RainMm         float64         `json:"rain_mm"`
+	WindMean       sql.NullFloat64 `json:"wind_mean"`
+	WindPrevailing sql.NullFloat64 `json:"wind_prevailing"`
+	GustMax        sql.NullFloat64 `json:"gust_max"`
+	GustTime       sql.NullTime    `json:"gust_time"`
+	GustDirection  sql.NullFloat64 `json:"gust_direction"`
+}
+
+type WeatherHourly struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	Samples        int32           `json:"samples"`
+	TempMin        sql.NullFloat64 `json:"temp_min"`
+	TempMax        sql.NullFloat64 `json:"temp_max"`
+	TempMean       sql.NullFloat64 `json:"temp_mean"`
+	PressureMin    sql.NullFloat64 `json:"pressure_min"`
+	PressureMax    sql.NullFloat64 `json:"pressure_max"`
+	MslpMin        sql.NullFloat64 `json:"mslp_min"`
+	MslpMax        sql.NullFloat64 `json:"mslp_max"`
+	RainMm         float64         `json:"rain_mm"`
+	WindMean       sql.NullFloat64 `json:"wind_mean"`
+	WindPrevailing sql.NullFloat64 `json:"wind_prevailing"`
+	GustMax        sql.NullFloat64 `json:"gust_max"`
+	GustTime       sql.NullTime    `json:"gust_time"`
+	GustDirection  sql.NullFloat64 `json:"gust_direction"`
+}
+
+type WeatherMonthly struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	Samples        int32           `json:"samples"`
+	TempMin        sql.NullFloat64 `json:"temp_min"`
+	TempMax        sql.NullFloat64 `json:"temp_max"`
+	TempMean       sql.NullFloat64 `json:"temp_mean"`
+	PressureMin    sql.NullFloat64 `json:"pressure_min"`
+	PressureMax    sql.NullFloat64 `json:"pressure_max"`
+	MslpMin        sql.NullFloat64 `json:"mslp_min"`
+	MslpMax        sql.NullFloat64 `json:"mslp_max"`
+	RainMm         float64         `json:"rain_mm"`
+	WindMean       sql.NullFloat64 `json:"wind_mean"`
+	WindPrevailing sql.NullFloat64 `json:"wind_prevailing"`
+	GustMax        sql.NullFloat64 `json:"gust_max"`
+	GustTime       sql.NullTime    `json:"gust_time"`
+	GustDirection  sql.NullFloat64 `json:"gust_direction"`
 }
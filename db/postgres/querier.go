@@ -6,10 +6,23 @@ package postgres
 
 import (
 	"context"
+	"time"
 )
 
 type Querier interface {
 	GetAllRecords(ctx context.Context) ([]Weather, error)
+	GetDailyPage(ctx context.Context, arg GetDailyPageParams) ([]WeatherDaily, error)
+	GetFirstRecordDate(ctx context.Context) (time.Time, error)
+	GetHourlyPage(ctx context.Context, arg GetHourlyPageParams) ([]WeatherHourly, error)
+	GetMonthlyPage(ctx context.Context, arg GetMonthlyPageParams) ([]WeatherMonthly, error)
+	// The records in a rollup period, after the start up to and including the end
+	GetRecordsBetween(ctx context.Context, arg GetRecordsBetweenParams) ([]Weather, error)
+	// Records from from_date up to but not including to_date
+	GetRecordsPage(ctx context.Context, arg GetRecordsPageParams) ([]Weather, error)
+	UpsertDaily(ctx context.Context, arg UpsertDailyParams) error
+	UpsertHourly(ctx context.Context, arg UpsertHourlyParams) error
+	UpsertMonthly(ctx context.Context, arg UpsertMonthlyParams) error
+	// A record sent again from the queue is ignored
 	WriteRecord(ctx context.Context, arg WriteRecordParams) error
 }
 
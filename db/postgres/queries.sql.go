@@ -7,10 +7,12 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const getAllRecords = `-- name: GetAllRecords :many
-SELECT record_date, temperature, pressure, rain_mm, wind_speed, wind_gust, wind_direction from weather
+SELECT record_date, temperature, pressure, rain_mm, wind_speed, wind_gust, wind_direction, humidity, dew_point, mslp, rain_rate, wind_gust_direction from weather
 `
 
 func (q *Queries) GetAllRecords(ctx context.Context) ([]Weather, error) {
@@ -30,6 +32,11 @@ func (q *Queries) GetAllRecords(ctx context.Context) ([]Weather, error) {
 			&i.WindSpeed,
 			&i.WindGust,
 			&i.WindDirection,
+			&i.Humidity,
+			&i.DewPoint,
+			&i.Mslp,
+			&i.RainRate,
+			&i.WindGustDirection,
 		); err != nil {
 			return nil, err
 		}
@@ -44,6 +51,501 @@ func (q *Queries) GetAllRecords(ctx context.Context) ([]Weather, error) {
 	return items, nil
 }
 
+const getDailyPage = `-- name: GetDailyPage :many
+SELECT period_start, samples, temp_min, temp_max, temp_mean, pressure_min, pressure_max, mslp_min, mslp_max, rain_mm, wind_mean, wind_prevailing, gust_max, gust_time, gust_direction FROM weather_daily
+WHERE period_start >= $1 AND period_start < $2
+ORDER BY period_start
+LIMIT $3
+`
+
+type GetDailyPageParams struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+	RowLimit int32     `json:"row_limit"`
+}
+
+func (q *Queries) GetDailyPage(ctx context.Context, arg GetDailyPageParams) ([]WeatherDaily, error) {
+	rows, err := q.query(ctx, q.getDailyPageStmt, getDailyPage, arg.FromDate, arg.ToDate, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WeatherDaily
+	for rows.Next() {
+		var i WeatherDaily
+		if err := rows.Scan(
+			&i.PeriodStart,
+			&i.Samples,
+			&i.TempMin,
+			&i.TempMax,
+			&i.TempMean,
+			&i.PressureMin,
+			&i.PressureMax,
+			&i.MslpMin,
+			&i.MslpMax,
+			&i.RainMm,
+			&i.WindMean,
+			&i.WindPrevailing,
+			&i.GustMax,
+			&i.GustTime,
+			&i.GustDirection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFirstRecordDate = `-- name: GetFirstRecordDate :one
+SELECT record_date FROM weather
+ORDER BY record_date
+LIMIT 1
+`
+
+func (q *Queries) GetFirstRecordDate(ctx context.Context) (time.Time, error) {
+	row := q.queryRow(ctx, q.getFirstRecordDateStmt, getFirstRecordDate)
+	var record_date time.Time
+	err := row.Scan(&record_date)
+	return record_date, err
+}
+
+const getHourlyPage = `-- name: GetHourlyPage :many
+SELECT period_start, samples, temp_min, temp_max, temp_mean, pressure_min, pressure_max, mslp_min, mslp_max, rain_mm, wind_mean, wind_prevailing, gust_max, gust_time, gust_direction FROM weather_hourly
+WHERE period_start >= $1 AND period_start < $2
+ORDER BY period_start
+LIMIT $3
+`
+
+type GetHourlyPageParams struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+	RowLimit int32     `json:"row_limit"`
+}
+
+func (q *Queries) GetHourlyPage(ctx context.Context, arg GetHourlyPageParams) ([]WeatherHourly, error) {
+	rows, err := q.query(ctx, q.getHourlyPageStmt, getHourlyPage, arg.FromDate, arg.ToDate, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WeatherHourly
+	for rows.Next() {
+		var i WeatherHourly
+		if err := rows.Scan(
+			&i.PeriodStart,
+			&i.Samples,
+			&i.TempMin,
+			&i.TempMax,
+			&i.TempMean,
+			&i.PressureMin,
+			&i.PressureMax,
+			&i.MslpMin,
+			&i.MslpMax,
+			&i.RainMm,
+			&i.WindMean,
+			&i.WindPrevailing,
+			&i.GustMax,
+			&i.GustTime,
+			&i.GustDirection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMonthlyPage = `-- name: GetMonthlyPage :many
+SELECT period_start, samples, temp_min, temp_max, temp_mean, pressure_min, pressure_max, mslp_min, mslp_max, rain_mm, wind_mean, wind_prevailing, gust_max, gust_time, gust_direction FROM weather_monthly
+WHERE period_start >= $1 AND period_start < $2
+ORDER BY period_start
+LIMIT $3
+`
+
+type GetMonthlyPageParams struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+	RowLimit int32     `json:"row_limit"`
+}
+
+func (q *Queries) GetMonthlyPage(ctx context.Context, arg GetMonthlyPageParams) ([]WeatherMonthly, error) {
+	rows, err := q.query(ctx, q.getMonthlyPageStmt, getMonthlyPage, arg.FromDate, arg.ToDate, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WeatherMonthly
+	for rows.Next() {
+		var i WeatherMonthly
+		if err := rows.Scan(
+			&i.PeriodStart,
+			&i.Samples,
+			&i.TempMin,
+			&i.TempMax,
+			&i.TempMean,
+			&i.PressureMin,
+			&i.PressureMax,
+			&i.MslpMin,
+			&i.MslpMax,
+			&i.RainMm,
+			&i.WindMean,
+			&i.WindPrevailing,
+			&i.GustMax,
+			&i.GustTime,
+			&i.GustDirection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecordsBetween = `-- name: GetRecordsBetween :many
+SELECT record_date, temperature, pressure, rain_mm, wind_speed, wind_gust, wind_direction, humidity, dew_point, mslp, rain_rate, wind_gust_direction FROM weather
+WHERE record_date > $1 AND record_date <= $2
+ORDER BY record_date
+`
+
+type GetRecordsBetweenParams struct {
+	After time.Time `json:"after"`
+	Until time.Time `json:"until"`
+}
+
+// The records in a rollup period, after the start up to and including the end
+func (q *Queries) GetRecordsBetween(ctx context.Context, arg GetRecordsBetweenParams) ([]Weather, error) {
+	rows, err := q.query(ctx, q.getRecordsBetweenStmt, getRecordsBetween, arg.After, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Weather
+	for rows.Next() {
+		var i Weather
+		if err := rows.Scan(
+			&i.RecordDate,
+			&i.Temperature,
+			&i.Pressure,
+			&i.RainMm,
+			&i.WindSpeed,
+			&i.WindGust,
+			&i.WindDirection,
+			&i.Humidity,
+			&i.DewPoint,
+			&i.Mslp,
+			&i.RainRate,
+			&i.WindGustDirection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecordsPage = `-- name: GetRecordsPage :many
+SELECT record_date, temperature, pressure, rain_mm, wind_speed, wind_gust, wind_direction, humidity, dew_point, mslp, rain_rate, wind_gust_direction FROM weather
+WHERE record_date >= $1 AND record_date < $2
+ORDER BY record_date
+LIMIT $3
+`
+
+type GetRecordsPageParams struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+	RowLimit int32     `json:"row_limit"`
+}
+
+// Records from from_date up to but not including to_date
+func (q *Queries) GetRecordsPage(ctx context.Context, arg GetRecordsPageParams) ([]Weather, error) {
+	rows, err := q.query(ctx, q.getRecordsPageStmt, getRecordsPage, arg.FromDate, arg.ToDate, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Weather
+	for rows.Next() {
+		var i Weather
+		if err := rows.Scan(
+			&i.RecordDate,
+			&i.Temperature,
+			&i.Pressure,
+			&i.RainMm,
+			&i.WindSpeed,
+			&i.WindGust,
+			&i.WindDirection,
+			&i.Humidity,
+			&i.DewPoint,
+			&i.Mslp,
+			&i.RainRate,
+			&i.WindGustDirection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertDaily = `-- name: UpsertDaily :exec
+INSERT INTO weather_daily (
+    period_start,
+    samples,
+    temp_min,
+    temp_max,
+    temp_mean,
+    pressure_min,
+    pressure_max,
+    mslp_min,
+    mslp_max,
+    rain_mm,
+    wind_mean,
+    wind_prevailing,
+    gust_max,
+    gust_time,
+    gust_direction
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (period_start) DO UPDATE SET
+    samples = excluded.samples,
+    temp_min = excluded.temp_min,
+    temp_max = excluded.temp_max,
+    temp_mean = excluded.temp_mean,
+    pressure_min = excluded.pressure_min,
+    pressure_max = excluded.pressure_max,
+    mslp_min = excluded.mslp_min,
+    mslp_max = excluded.mslp_max,
+    rain_mm = excluded.rain_mm,
+    wind_mean = excluded.wind_mean,
+    wind_prevailing = excluded.wind_prevailing,
+    gust_max = excluded.gust_max,
+    gust_time = excluded.gust_time,
+    gust_direction = excluded.gust_direction
+`
+
+type UpsertDailyParams struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	Samples        int32           `json:"samples"`
+	TempMin        sql.NullFloat64 `json:"temp_min"`
+	TempMax        sql.NullFloat64 `json:"temp_max"`
+	TempMean       sql.NullFloat64 `json:"temp_mean"`
+	PressureMin    sql.NullFloat64 `json:"pressure_min"`
+	PressureMax    sql.NullFloat64 `json:"pressure_max"`
+	MslpMin        sql.NullFloat64 `json:"mslp_min"`
+	MslpMax        sql.NullFloat64 `json:"mslp_max"`
+	RainMm         float64         `json:"rain_mm"`
+	WindMean       sql.NullFloat64 `json:"wind_mean"`
+	WindPrevailing sql.NullFloat64 `json:"wind_prevailing"`
+	GustMax        sql.NullFloat64 `json:"gust_max"`
+	GustTime       sql.NullTime    `json:"gust_time"`
+	GustDirection  sql.NullFloat64 `json:"gust_direction"`
+}
+
+func (q *Queries) UpsertDaily(ctx context.Context, arg UpsertDailyParams) error {
+	_, err := q.exec(ctx, q.upsertDailyStmt, upsertDaily,
+		arg.PeriodStart,
+		arg.Samples,
+		arg.TempMin,
+		arg.TempMax,
+		arg.TempMean,
+		arg.PressureMin,
+		arg.PressureMax,
+		arg.MslpMin,
+		arg.MslpMax,
+		arg.RainMm,
+		arg.WindMean,
+		arg.WindPrevailing,
+		arg.GustMax,
+		arg.GustTime,
+		arg.GustDirection,
+	)
+	return err
+}
+
+const upsertHourly = `-- name: UpsertHourly :exec
+INSERT INTO weather_hourly (
+    period_start,
+    samples,
+    temp_min,
+    temp_max,
+    temp_mean,
+    pressure_min,
+    pressure_max,
+    mslp_min,
+    mslp_max,
+    rain_mm,
+    wind_mean,
+    wind_prevailing,
+    gust_max,
+    gust_time,
+    gust_direction
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (period_start) DO UPDATE SET
+    samples = excluded.samples,
+    temp_min = excluded.temp_min,
+    temp_max = excluded.temp_max,
+    temp_mean = excluded.temp_mean,
+    pressure_min = excluded.pressure_min,
+    pressure_max = excluded.pressure_max,
+    mslp_min = excluded.mslp_min,
+    mslp_max = excluded.mslp_max,
+    rain_mm = excluded.rain_mm,
+    wind_mean = excluded.wind_mean,
+    wind_prevailing = excluded.wind_prevailing,
+    gust_max = excluded.gust_max,
+    gust_time = excluded.gust_time,
+    gust_direction = excluded.gust_direction
+`
+
+type UpsertHourlyParams struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	Samples        int32           `json:"samples"`
+	TempMin        sql.NullFloat64 `json:"temp_min"`
+	TempMax        sql.NullFloat64 `json:"temp_max"`
+	TempMean       sql.NullFloat64 `json:"temp_mean"`
+	PressureMin    sql.NullFloat64 `json:"pressure_min"`
+	PressureMax    sql.NullFloat64 `json:"pressure_max"`
+	MslpMin        sql.NullFloat64 `json:"mslp_min"`
+	MslpMax        sql.NullFloat64 `json:"mslp_max"`
+	RainMm         float64         `json:"rain_mm"`
+	WindMean       sql.NullFloat64 `json:"wind_mean"`
+	WindPrevailing sql.NullFloat64 `json:"wind_prevailing"`
+	GustMax        sql.NullFloat64 `json:"gust_max"`
+	GustTime       sql.NullTime    `json:"gust_time"`
+	GustDirection  sql.NullFloat64 `json:"gust_direction"`
+}
+
+func (q *Queries) UpsertHourly(ctx context.Context, arg UpsertHourlyParams) error {
+	_, err := q.exec(ctx, q.upsertHourlyStmt, upsertHourly,
+		arg.PeriodStart,
+		arg.Samples,
+		arg.TempMin,
+		arg.TempMax,
+		arg.TempMean,
+		arg.PressureMin,
+		arg.PressureMax,
+		arg.MslpMin,
+		arg.MslpMax,
+		arg.RainMm,
+		arg.WindMean,
+		arg.WindPrevailing,
+		arg.GustMax,
+		arg.GustTime,
+		arg.GustDirection,
+	)
+	return err
+}
+
+const upsertMonthly = `-- name: UpsertMonthly :exec
+INSERT INTO weather_monthly (
+    period_start,
+    samples,
+    temp_min,
+    temp_max,
+    temp_mean,
+    pressure_min,
+    pressure_max,
+    mslp_min,
+    mslp_max,
+    rain_mm,
+    wind_mean,
+    wind_prevailing,
+    gust_max,
+    gust_time,
+    gust_direction
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (period_start) DO UPDATE SET
+    samples = excluded.samples,
+    temp_min = excluded.temp_min,
+    temp_max = excluded.temp_max,
+    temp_mean = excluded.temp_mean,
+    pressure_min = excluded.pressure_min,
+    pressure_max = excluded.pressure_max,
+    mslp_min = excluded.mslp_min,
+    mslp_max = excluded.mslp_max,
+    rain_mm = excluded.rain_mm,
+    wind_mean = excluded.wind_mean,
+    wind_prevailing = excluded.wind_prevailing,
+    gust_max = excluded.gust_max,
+    gust_time = excluded.gust_time,
+    gust_direction = excluded.gust_direction
+`
+
+type UpsertMonthlyParams struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	Samples        int32           `json:"samples"`
+	TempMin        sql.NullFloat64 `json:"temp_min"`
+	TempMax        sql.NullFloat64 `json:"temp_max"`
+	TempMean       sql.NullFloat64 `json:"temp_mean"`
+	PressureMin    sql.NullFloat64 `json:"pressure_min"`
+	PressureMax    sql.NullFloat64 `json:"pressure_max"`
+	MslpMin        sql.NullFloat64 `json:"mslp_min"`
+	MslpMax        sql.NullFloat64 `json:"mslp_max"`
+	RainMm         float64         `json:"rain_mm"`
+	WindMean       sql.NullFloat64 `json:"wind_mean"`
+	WindPrevailing sql.NullFloat64 `json:"wind_prevailing"`
+	GustMax        sql.NullFloat64 `json:"gust_max"`
+	GustTime       sql.NullTime    `json:"gust_time"`
+	GustDirection  sql.NullFloat64 `json:"gust_direction"`
+}
+
+func (q *Queries) UpsertMonthly(ctx context.Context, arg UpsertMonthlyParams) error {
+	_, err := q.exec(ctx, q.upsertMonthlyStmt, upsertMonthly,
+		arg.PeriodStart,
+		arg.Samples,
+		arg.TempMin,
+		arg.TempMax,
+		arg.TempMean,
+		arg.PressureMin,
+		arg.PressureMax,
+		arg.MslpMin,
+		arg.MslpMax,
+		arg.RainMm,
+		arg.WindMean,
+		arg.WindPrevailing,
+		arg.GustMax,
+		arg.GustTime,
+		arg.GustDirection,
+	)
+	return err
+}
+
 const writeRecord = `-- name: WriteRecord :exec
 INSERT INTO weather (
     record_date,
@@ -52,29 +554,48 @@ INSERT INTO weather (
     rain_mm,
     wind_speed,
     wind_gust,
-    wind_direction
+    wind_direction,
+    humidity,
+    dew_point,
+    mslp,
+    rain_rate,
+    wind_gust_direction
 ) VALUES (
-    now(), $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 )
+ON CONFLICT (record_date) DO NOTHING
 `
 
 type WriteRecordParams struct {
-	Temperature   float64 `json:"temperature"`
-	Pressure      float64 `json:"pressure"`
-	RainMm        float64 `json:"rain_mm"`
-	WindSpeed     float64 `json:"wind_speed"`
-	WindGust      float64 `json:"wind_gust"`
-	WindDirection float64 `json:"wind_direction"`
+	RecordDate        time.Time       `json:"record_date"`
+	Temperature       sql.NullFloat64 `json:"temperature"`
+	Pressure          sql.NullFloat64 `json:"pressure"`
+	RainMm            float64         `json:"rain_mm"`
+	WindSpeed         sql.NullFloat64 `json:"wind_speed"`
+	WindGust          sql.NullFloat64 `json:"wind_gust"`
+	WindDirection     sql.NullFloat64 `json:"wind_direction"`
+	Humidity          sql.NullFloat64 `json:"humidity"`
+	DewPoint          sql.NullFloat64 `json:"dew_point"`
+	Mslp              sql.NullFloat64 `json:"mslp"`
+	RainRate          sql.NullFloat64 `json:"rain_rate"`
+	WindGustDirection sql.NullFloat64 `json:"wind_gust_direction"`
 }
 
+// A record sent again from the queue is ignored
 func (q *Queries) WriteRecord(ctx context.Context, arg WriteRecordParams) error {
 	_, err := q.exec(ctx, q.writeRecordStmt, writeRecord,
+		arg.RecordDate,
 		arg.Temperature,
 		arg.Pressure,
 		arg.RainMm,
 		arg.WindSpeed,
 		arg.WindGust,
 		arg.WindDirection,
+		arg.Humidity,
+		arg.DewPoint,
+		arg.Mslp,
+		arg.RainRate,
+		arg.WindGustDirection,
 	)
 	return err
 }
@@ -2,6 +2,7 @@
 SELECT * from weather;
 
 -- name: WriteRecord :exec
+-- A record sent again from the queue is ignored
 INSERT INTO weather (
     record_date,
     temperature,
@@ -9,9 +10,157 @@ INSERT INTO weather (
     rain_mm,
     wind_speed,
     wind_gust,
-    wind_direction
+    wind_direction,
+    humidity,
+    dew_point,
+    mslp,
+    rain_rate,
+    wind_gust_direction
 ) VALUES (
-    now(), $1, $2, $3, $4, $5, $6
-);
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+)
+ON CONFLICT (record_date) DO NOTHING;
 
+-- name: GetFirstRecordDate :one
+SELECT record_date FROM weather
+ORDER BY record_date
+LIMIT 1;
 
+-- name: GetRecordsBetween :many
+-- The records in a rollup period, after the start up to and including the end
+SELECT * FROM weather
+WHERE record_date > @after AND record_date <= @until
+ORDER BY record_date;
+
+-- name: UpsertHourly :exec
+INSERT INTO weather_hourly (
+    period_start,
+    samples,
+    temp_min,
+    temp_max,
+    temp_mean,
+    pressure_min,
+    pressure_max,
+    mslp_min,
+    mslp_max,
+    rain_mm,
+    wind_mean,
+    wind_prevailing,
+    gust_max,
+    gust_time,
+    gust_direction
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (period_start) DO UPDATE SET
+    samples = excluded.samples,
+    temp_min = excluded.temp_min,
+    temp_max = excluded.temp_max,
+    temp_mean = excluded.temp_mean,
+    pressure_min = excluded.pressure_min,
+    pressure_max = excluded.pressure_max,
+    mslp_min = excluded.mslp_min,
+    mslp_max = excluded.mslp_max,
+    rain_mm = excluded.rain_mm,
+    wind_mean = excluded.wind_mean,
+    wind_prevailing = excluded.wind_prevailing,
+    gust_max = excluded.gust_max,
+    gust_time = excluded.gust_time,
+    gust_direction = excluded.gust_direction;
+
+-- name: UpsertDaily :exec
+INSERT INTO weather_daily (
+    period_start,
+    samples,
+    temp_min,
+    temp_max,
+    temp_mean,
+    pressure_min,
+    pressure_max,
+    mslp_min,
+    mslp_max,
+    rain_mm,
+    wind_mean,
+    wind_prevailing,
+    gust_max,
+    gust_time,
+    gust_direction
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (period_start) DO UPDATE SET
+    samples = excluded.samples,
+    temp_min = excluded.temp_min,
+    temp_max = excluded.temp_max,
+    temp_mean = excluded.temp_mean,
+    pressure_min = excluded.pressure_min,
+    pressure_max = excluded.pressure_max,
+    mslp_min = excluded.mslp_min,
+    mslp_max = excluded.mslp_max,
+    rain_mm = excluded.rain_mm,
+    wind_mean = excluded.wind_mean,
+    wind_prevailing = excluded.wind_prevailing,
+    gust_max = excluded.gust_max,
+    gust_time = excluded.gust_time,
+    gust_direction = excluded.gust_direction;
+
+-- name: UpsertMonthly :exec
+INSERT INTO weather_monthly (
+    period_start,
+    samples,
+    temp_min,
+    temp_max,
+    temp_mean,
+    pressure_min,
+    pressure_max,
+    mslp_min,
+    mslp_max,
+    rain_mm,
+    wind_mean,
+    wind_prevailing,
+    gust_max,
+    gust_time,
+    gust_direction
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+)
+ON CONFLICT (period_start) DO UPDATE SET
+    samples = excluded.samples,
+    temp_min = excluded.temp_min,
+    temp_max = excluded.temp_max,
+    temp_mean = excluded.temp_mean,
+    pressure_min = excluded.pressure_min,
+    pressure_max = excluded.pressure_max,
+    mslp_min = excluded.mslp_min,
+    mslp_max = excluded.mslp_max,
+    rain_mm = excluded.rain_mm,
+    wind_mean = excluded.wind_mean,
+    wind_prevailing = excluded.wind_prevailing,
+    gust_max = excluded.gust_max,
+    gust_time = excluded.gust_time,
+    gust_direction = excluded.gust_direction;
+
+-- name: GetRecordsPage :many
+-- Records from from_date up to but not including to_date
+SELECT * FROM weather
+WHERE record_date >= @from_date AND record_date < @to_date
+ORDER BY record_date
+LIMIT @row_limit;
+
+-- name: GetHourlyPage :many
+SELECT * FROM weather_hourly
+WHERE period_start >= @from_date AND period_start < @to_date
+ORDER BY period_start
+LIMIT @row_limit;
+
+-- name: GetDailyPage :many
+SELECT * FROM weather_daily
+WHERE period_start >= @from_date AND period_start < @to_date
+ORDER BY period_start
+LIMIT @row_limit;
+
+-- name: GetMonthlyPage :many
+SELECT * FROM weather_monthly
+WHERE period_start >= @from_date AND period_start < @to_date
+ORDER BY period_start
+LIMIT @row_limit;
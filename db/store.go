@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gr-butler/weather/db/migrate"
+	"github.com/gr-butler/weather/db/postgres"
+	"github.com/gr-butler/weather/env"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// migrations is the schema for each driver, applied in order by db/migrate
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrations embed.FS
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Storage is where the records go. The sqlc queries in db/postgres are written
+// to run on both Postgres and SQLite so either is behind the same Querier.
+type Storage interface {
+	postgres.Querier
+	Migrator() (*migrate.Migrator, error)
+	Close() error
+}
+
+// Store is a Storage on a database/sql connection
+type Store struct {
+	*postgres.Queries
+	conn   *sql.DB
+	driver string
+}
+
+// Open connects to the db picked in the config, it doesn't check the schema.
+func Open(cfg env.Database) (*Store, error) {
+	var conn *sql.DB
+	var err error
+	switch cfg.Driver {
+	case Postgres:
+		psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name)
+		conn, err = sql.Open("postgres", psqlInfo)
+	case SQLite:
+		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+			return nil, err
+		}
+		// WAL so a power cut can't corrupt it, and wait rather than fail if it's busy
+		conn, err = sql.Open("sqlite", "file:"+cfg.Path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+		if err == nil {
+			// one writer at a time anyway
+			conn.SetMaxOpenConns(1)
+		}
+	default:
+		return nil, fmt.Errorf("unknown database driver [%v]", cfg.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Queries: postgres.New(conn), conn: conn, driver: cfg.Driver}, nil
+}
+
+// Migrator has the migrations for this driver
+func (s *Store) Migrator() (*migrate.Migrator, error) {
+	m, err := migrate.Load(migrations, path.Join("migrations", s.driver))
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(s.conn, m), nil
+}
+
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
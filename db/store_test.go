@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/db/migrate"
+	"github.com/gr-butler/weather/db/postgres"
+	"github.com/gr-butler/weather/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedded(t *testing.T) {
+	for _, driver := range []string{Postgres, SQLite} {
+		migrations, err := migrate.Load(migrations, path.Join("migrations", driver))
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations, driver)
+		for i, m := range migrations {
+			require.Equal(t, i+1, m.Version)
+			require.NotEmpty(t, m.Down, m.Name)
+		}
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	cfg := env.Default().Database
+	cfg.Driver = SQLite
+	cfg.Path = filepath.Join(t.TempDir(), "weather", "weather.db")
+	s, err := Open(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	m, err := s.Migrator()
+	require.NoError(t, err)
+	require.ErrorIs(t, m.Check(ctx), migrate.ErrWrongVersion)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.NoError(t, m.Check(ctx))
+
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	rec := postgres.WriteRecordParams{
+		RecordDate:  at,
+		Temperature: sql.NullFloat64{Float64: 12.5, Valid: true},
+		RainMm:      0.2,
+	}
+	require.NoError(t, s.WriteRecord(ctx, rec))
+	// sent again from the queue
+	require.NoError(t, s.WriteRecord(ctx, rec))
+
+	records, err := s.GetAllRecords(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.True(t, at.Equal(records[0].RecordDate))
+	require.Equal(t, 12.5, records[0].Temperature.Float64)
+	require.False(t, records[0].Pressure.Valid)
+
+	// rollups read a period at a time, after the start up to and including the end
+	rec.RecordDate = at.Add(15 * time.Minute)
+	require.NoError(t, s.WriteRecord(ctx, rec))
+	first, err := s.GetFirstRecordDate(ctx)
+	require.NoError(t, err)
+	require.True(t, at.Equal(first))
+	records, err = s.GetRecordsBetween(ctx, postgres.GetRecordsBetweenParams{After: at, Until: at.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	records, err = s.GetRecordsBetween(ctx, postgres.GetRecordsBetweenParams{After: at.Add(-time.Hour), Until: at.Add(15 * time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	day := postgres.UpsertDailyParams{PeriodStart: at, Samples: 1, RainMm: 0.2}
+	require.NoError(t, s.UpsertDaily(ctx, day))
+	day.Samples = 2
+	require.NoError(t, s.UpsertDaily(ctx, day))
+
+	for range m.Latest() {
+		_, err := m.Down(ctx)
+		require.NoError(t, err)
+	}
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, version)
+}
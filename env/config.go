@@ -0,0 +1,267 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default is the config for my station, anything not in the config file keeps these values.
+func Default() *Config {
+	return &Config{
+		Station: Station{
+			ID:       "culverhay",
+			Altitude: 24.71, // River aOD is 16.61, river height at 4.1m is level with the road and I'm 3m above that
+		},
+		Database: Database{
+			Driver:    "postgres",
+			Path:      "/var/lib/weather/weather.db",
+			Host:      "server.internal",
+			Port:      5432,
+			User:      "weather",
+			Name:      "weather",
+			QueueFile: "/var/lib/weather/db-queue.jsonl",
+		},
+		MQTT: MQTT{
+			Broker:   "tcp://server.internal:1883",
+			ClientID: "weather-mqtt-client",
+			Topic:    "culverhay/weather",
+		},
+		HTTP: HTTP{
+			Listen: ":80",
+		},
+		Wow: Wow{
+			Enabled:   true,
+			FreqMin:   15,
+			QueueFile: "/var/lib/weather/wow-queue.jsonl",
+		},
+		WU: WU{
+			FreqMin: 5,
+		},
+		CWOP: CWOP{
+			Passcode: "-1",
+			Server:   "cwop.aprs.net:14580",
+			FreqMin:  10,
+		},
+		Windy: Windy{
+			FreqMin:     5,
+			ShareOption: "Open",
+		},
+		Reporting: Reporting{
+			FreqMin: 15,
+		},
+		Sensors: Sensors{
+			I2CBus:       "1",
+			HeartbeatLed: GPIO20,
+			Atmosphere: Atmosphere{
+				Enabled: true,
+				MCP9808: 0x18,
+				BME280:  0x76,
+			},
+			Rain: Rain{
+				Enabled: true,
+				Pin:     GPIO12,
+				TipLed:  GPIO19,
+				// https://www.robotics.org.za/WH-SP-RG
+				// https://forum.mysensors.org/topic/9594/misol-rain-gauge-tipping-bucket-rain-amount
+				MmPerTip: 0.3537,
+			},
+			Wind: Wind{
+				Enabled:                true,
+				Masthead:               0x55,
+				ADC:                    0x48,
+				MphPerTick:             1.429,
+				SpeedWeightedDirection: true,
+				MeanShortSeconds:       120,
+				MeanLongSeconds:        600,
+				GustSeconds:            3,
+				GustWindowSeconds:      600,
+				Vane: Vane{
+					Model:       "misol",
+					SupplyVolts: 5,
+					PullupOhms:  10000,
+				},
+			},
+		},
+		Flags: Flags{
+			ReplaySpeed: 1,
+		},
+	}
+}
+
+// Load reads the config file at path over the defaults and then applies any
+// environment variable overrides. It does not validate the result.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// a misspelt key is an error, not a silent default
+		d := yaml.NewDecoder(bytes.NewReader(b))
+		d.KnownFields(true)
+		if err := d.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(c).Elem()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv sets any field with an `env` tag from the environment variable of that name.
+func applyEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		sf := v.Type().Field(i)
+		if f.Kind() == reflect.Struct {
+			if err := applyEnv(f); err != nil {
+				return err
+			}
+			continue
+		}
+		name := sf.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		var err error
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(val)
+		case reflect.Bool:
+			var b bool
+			b, err = strconv.ParseBool(val)
+			f.SetBool(b)
+		case reflect.Int:
+			var n int64
+			n, err = strconv.ParseInt(val, 0, 64)
+			f.SetInt(n)
+		case reflect.Uint16:
+			var n uint64
+			n, err = strconv.ParseUint(val, 0, 16)
+			f.SetUint(n)
+		case reflect.Float64:
+			var x float64
+			x, err = strconv.ParseFloat(val, 64)
+			f.SetFloat(x)
+		default:
+			err = fmt.Errorf("unsupported type %v", f.Kind())
+		}
+		if err != nil {
+			return fmt.Errorf("environment variable %v=%q: %w", name, val, err)
+		}
+	}
+	return nil
+}
+
+var gpioName = regexp.MustCompile(`^GPIO\d+$`)
+
+// Validate checks the config makes sense, all the problems are returned together.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	check(c.Station.Latitude >= -90 && c.Station.Latitude <= 90, "station.latitude [%v] should be -90 to 90", c.Station.Latitude)
+	check(c.Station.Longitude >= -180 && c.Station.Longitude <= 180, "station.longitude [%v] should be -180 to 180", c.Station.Longitude)
+	check(c.Station.Altitude > -500 && c.Station.Altitude < 9000, "station.altitude [%v] should be metres above sea level", c.Station.Altitude)
+
+	switch c.Database.Driver {
+	case "postgres":
+		check(c.Database.Host != "", "database.host is not set")
+		check(c.Database.Port > 0 && c.Database.Port < 65536, "database.port [%v] is not a valid port", c.Database.Port)
+		check(c.Database.User != "", "database.user is not set")
+		check(c.Database.Password != "", "database.password is not set (set it in the config file or WEATHER_DB_PASSWORD)")
+		check(c.Database.Name != "", "database.name is not set")
+	case "sqlite":
+		check(c.Database.Path != "", "database.path is not set")
+	default:
+		errs = append(errs, fmt.Errorf("database.driver [%v] should be postgres or sqlite", c.Database.Driver))
+	}
+	check(c.Database.QueueFile != "", "database.queue_file is not set")
+
+	if u, err := url.Parse(c.MQTT.Broker); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("mqtt.broker [%v] should look like tcp://host:1883", c.MQTT.Broker))
+	}
+	check(c.MQTT.ClientID != "", "mqtt.client_id is not set")
+	check(c.MQTT.Topic != "", "mqtt.topic is not set")
+
+	check(c.HTTP.Listen != "", "http.listen is not set")
+
+	check(c.Reporting.FreqMin > 0 && 60%c.Reporting.FreqMin == 0, "reporting.freq_min [%v] must divide into 60", c.Reporting.FreqMin)
+	if c.Wow.Enabled {
+		check(c.Wow.FreqMin > 0 && 60%c.Wow.FreqMin == 0, "wow.freq_min [%v] must divide into 60", c.Wow.FreqMin)
+		check(c.Wow.QueueFile != "", "wow.queue_file is not set")
+	}
+	if c.WU.Enabled {
+		check(c.WU.FreqMin > 0 && 60%c.WU.FreqMin == 0, "wunderground.freq_min [%v] must divide into 60", c.WU.FreqMin)
+		// they ask for no more than one every 2.5 seconds
+		check(c.WU.RapidFireSeconds == 0 || (c.WU.RapidFireSeconds >= 3 && c.WU.RapidFireSeconds <= 60),
+			"wunderground.rapid_fire_seconds [%v] should be 0 (off) or 3 to 60", c.WU.RapidFireSeconds)
+	}
+	if c.CWOP.Enabled {
+		check(c.CWOP.Server != "", "cwop.server is not set")
+		// they don't want them any more often than every 5 minutes
+		check(c.CWOP.FreqMin >= 5 && 60%c.CWOP.FreqMin == 0, "cwop.freq_min [%v] must be at least 5 and divide into 60", c.CWOP.FreqMin)
+		check(c.Station.Latitude != 0 || c.Station.Longitude != 0, "station.latitude and longitude are needed for cwop")
+	}
+	if c.Windy.Enabled {
+		check(c.Windy.FreqMin >= 5 && 60%c.Windy.FreqMin == 0, "windy.freq_min [%v] must be at least 5 and divide into 60", c.Windy.FreqMin)
+		check(c.Windy.StationID >= 0, "windy.station_id [%v] can't be negative", c.Windy.StationID)
+		switch c.Windy.ShareOption {
+		case "", "Open", "Only Windy", "Private":
+		default:
+			errs = append(errs, fmt.Errorf("windy.share_option [%v] should be Open, Only Windy or Private", c.Windy.ShareOption))
+		}
+	}
+
+	check(c.Sensors.I2CBus != "", "sensors.i2c_bus is not set")
+	check(gpioName.MatchString(c.Sensors.HeartbeatLed), "sensors.heartbeat_led [%v] should be a pin name like GPIO20", c.Sensors.HeartbeatLed)
+	if c.Sensors.Atmosphere.Enabled {
+		check(validI2C(c.Sensors.Atmosphere.MCP9808), "sensors.atmosphere.mcp9808_address [%#x] is not a valid I2C address", c.Sensors.Atmosphere.MCP9808)
+		check(validI2C(c.Sensors.Atmosphere.BME280), "sensors.atmosphere.bme280_address [%#x] is not a valid I2C address", c.Sensors.Atmosphere.BME280)
+	}
+	if c.Sensors.Rain.Enabled {
+		check(gpioName.MatchString(c.Sensors.Rain.Pin), "sensors.rain.pin [%v] should be a pin name like GPIO12", c.Sensors.Rain.Pin)
+		check(gpioName.MatchString(c.Sensors.Rain.TipLed), "sensors.rain.tip_led [%v] should be a pin name like GPIO19", c.Sensors.Rain.TipLed)
+		check(c.Sensors.Rain.MmPerTip > 0, "sensors.rain.mm_per_tip [%v] must be more than 0", c.Sensors.Rain.MmPerTip)
+	}
+	if c.Sensors.Wind.Enabled {
+		check(validI2C(c.Sensors.Wind.Masthead), "sensors.wind.masthead_address [%#x] is not a valid I2C address", c.Sensors.Wind.Masthead)
+		check(validI2C(c.Sensors.Wind.ADC), "sensors.wind.adc_address [%#x] is not a valid I2C address", c.Sensors.Wind.ADC)
+		check(c.Sensors.Wind.MphPerTick > 0, "sensors.wind.mph_per_tick [%v] must be more than 0", c.Sensors.Wind.MphPerTick)
+		check(c.Sensors.Wind.MeanShortSeconds > 0, "sensors.wind.mean_short_seconds [%v] must be more than 0", c.Sensors.Wind.MeanShortSeconds)
+		check(c.Sensors.Wind.MeanLongSeconds > 0, "sensors.wind.mean_long_seconds [%v] must be more than 0", c.Sensors.Wind.MeanLongSeconds)
+		check(c.Sensors.Wind.GustSeconds > 0, "sensors.wind.gust_seconds [%v] must be more than 0", c.Sensors.Wind.GustSeconds)
+		check(c.Sensors.Wind.GustWindowSeconds >= c.Sensors.Wind.GustSeconds, "sensors.wind.gust_window_seconds [%v] must be at least gust_seconds", c.Sensors.Wind.GustWindowSeconds)
+		if _, err := c.Sensors.Wind.Vane.Points(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	check(c.Flags.ReplaySpeed > 0, "-replayspeed [%v] must be more than 0", c.Flags.ReplaySpeed)
+
+	return errors.Join(errs...)
+}
+
+// 7 bit addresses, 0-2 and 0x78 up are reserved
+func validI2C(addr uint16) bool {
+	return addr >= 0x03 && addr <= 0x77
+}
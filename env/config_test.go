@@ -0,0 +1,78 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather.yaml")
+	err := os.WriteFile(path, []byte(`
+station:
+  altitude: 120
+database:
+  host: db.example
+  password: secret
+sensors:
+  wind:
+    masthead_address: 0x56
+`), 0600)
+	require.NoError(t, err)
+
+	t.Setenv("WEATHER_DB_HOST", "other.example")
+	t.Setenv("WOWSITEID", "1234")
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, 120.0, c.Station.Altitude)
+	require.Equal(t, "other.example", c.Database.Host)
+	require.Equal(t, "secret", c.Database.Password)
+	require.Equal(t, "1234", c.Wow.SiteID)
+	require.Equal(t, uint16(0x56), c.Sensors.Wind.Masthead)
+	// not in the file so still the default
+	require.Equal(t, 5432, c.Database.Port)
+	require.Equal(t, GPIO12, c.Sensors.Rain.Pin)
+	require.NoError(t, c.Validate())
+}
+
+func TestUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather.yaml")
+	err := os.WriteFile(path, []byte(`
+database:
+  pasword: secret
+`), 0600)
+	require.NoError(t, err)
+
+	_, err = Load(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pasword")
+
+	// empty is fine, it's all defaults
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	_, err = Load(path)
+	require.NoError(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Reporting.FreqMin = 7
+	c.Sensors.Rain.Pin = "12"
+	c.MQTT.Broker = "server.internal"
+
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "database.password is not set")
+	require.Contains(t, err.Error(), "reporting.freq_min [7]")
+	require.Contains(t, err.Error(), "sensors.rain.pin [12]")
+	require.Contains(t, err.Error(), "mqtt.broker [server.internal]")
+}
+
+func TestBadEnv(t *testing.T) {
+	t.Setenv("WEATHER_DB_PORT", "lots")
+	_, err := Load("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "WEATHER_DB_PORT")
+}
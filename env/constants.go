@@ -33,32 +33,14 @@ const (
 	GPIO28 = "GPIO28"
 	GPIO29 = "GPIO29"
 
-	RainSensorIn = GPIO12
-	WindSensorIn = GPIO27
-
-	HeartbeatLed = GPIO20
-	RainTipLed   = GPIO19
-
-	MphPerTick = 1.429
-
-	HPaToInHg     = 0.02953
-	MmToInch      = 25.4
-	ReportFreqMin = 15
+	HPaToInHg = 0.02953
+	MmToInch  = 25.4
 
 	LEDFlashDuration = time.Millisecond * 50
 
-	MastHead uint16 = 0x55
-
 	// https://www.metoffice.gov.uk/weather/guides/observations/how-we-measure-wind
 
 	// Because wind is an element that varies rapidly over very short periods of time
 	// it is sampled at high frequency (every 0.25 sec)
-	WindSamplesPerSecond    = 4
-	WindBufferLengthSeconds = 60
-	// https://www.robotics.org.za/WH-SP-RG
-	// https://forum.mysensors.org/topic/9594/misol-rain-gauge-tipping-bucket-rain-amount
-	MmPerTip = 0.3537
+	WindSamplesPerSecond = 4
 )
-
-var Disabled = false
-var Enabled = true
@@ -1,17 +1,152 @@
 package env
 
-type Args struct {
-	Test               *bool
-	NoWow              *bool
-	Verbose            *bool
-	Imuon              *bool
-	Speedon            *bool
-	Diron              *bool
-	Rainon             *bool
-	WindEnabled        *bool
-	AtmosphericEnabled *bool
-	RainEnabled        *bool
-	Humidity           *bool
-	WowSiteID          string
-	WowPin             string
+// Config is everything that can be different from one station to the next. It is
+// loaded from a yaml file, environment variables override the file and then the
+// command line flags override both. See weather.example.yaml.
+type Config struct {
+	Station   Station   `yaml:"station"`
+	Database  Database  `yaml:"database"`
+	MQTT      MQTT      `yaml:"mqtt"`
+	HTTP      HTTP      `yaml:"http"`
+	Wow       Wow       `yaml:"wow"`
+	WU        WU        `yaml:"wunderground"`
+	CWOP      CWOP      `yaml:"cwop"`
+	Windy     Windy     `yaml:"windy"`
+	Reporting Reporting `yaml:"reporting"`
+	Sensors   Sensors   `yaml:"sensors"`
+	Flags     Flags     `yaml:"-"`
+}
+
+type Station struct {
+	// shown in the api, the uploaders have their own ids
+	ID        string  `yaml:"id" env:"WEATHER_STATION_ID"`
+	Latitude  float64 `yaml:"latitude" env:"WEATHER_LATITUDE"`
+	Longitude float64 `yaml:"longitude" env:"WEATHER_LONGITUDE"`
+	// z0, metres above sea level of the pressure sensor, used for the sea level pressure
+	Altitude float64 `yaml:"altitude" env:"WEATHER_ALTITUDE"`
+}
+
+type Database struct {
+	// postgres, or sqlite for a local file at Path
+	Driver   string `yaml:"driver" env:"WEATHER_DB_DRIVER"`
+	Path     string `yaml:"path" env:"WEATHER_DB_PATH"`
+	Host     string `yaml:"host" env:"WEATHER_DB_HOST"`
+	Port     int    `yaml:"port" env:"WEATHER_DB_PORT"`
+	User     string `yaml:"user" env:"WEATHER_DB_USER"`
+	Password string `yaml:"password" env:"WEATHER_DB_PASSWORD"`
+	Name     string `yaml:"name" env:"WEATHER_DB_NAME"`
+	// records wait here until the db has them
+	QueueFile string `yaml:"queue_file" env:"WEATHER_DB_QUEUE"`
+}
+
+type MQTT struct {
+	Broker   string `yaml:"broker" env:"WEATHER_MQTT_BROKER"`
+	ClientID string `yaml:"client_id" env:"WEATHER_MQTT_CLIENT_ID"`
+	Topic    string `yaml:"topic" env:"WEATHER_MQTT_TOPIC"`
+}
+
+type HTTP struct {
+	Listen string `yaml:"listen" env:"WEATHER_HTTP_LISTEN"`
+}
+
+type Wow struct {
+	Enabled bool   `yaml:"enabled" env:"SENDWOWDATA"`
+	SiteID  string `yaml:"site_id" env:"WOWSITEID"`
+	Pin     string `yaml:"pin" env:"WOWPIN"`
+	// how often the met office get an observation, must divide into an hour
+	FreqMin int `yaml:"freq_min" env:"WOWFREQMIN"`
+	// observations that didn't get there wait here to be sent later
+	QueueFile string `yaml:"queue_file" env:"WEATHER_WOW_QUEUE"`
+}
+
+// WU is Weather Underground
+type WU struct {
+	Enabled   bool   `yaml:"enabled" env:"WEATHER_WU_ENABLED"`
+	StationID string `yaml:"station_id" env:"WEATHER_WU_STATION_ID"`
+	Key       string `yaml:"key" env:"WEATHER_WU_KEY"`
+	// how often they get an observation, must divide into an hour
+	FreqMin int `yaml:"freq_min" env:"WEATHER_WU_FREQ_MIN"`
+	// rapid fire uploads every this many seconds instead, 0 is off
+	RapidFireSeconds int `yaml:"rapid_fire_seconds" env:"WEATHER_WU_RAPID_FIRE_SECONDS"`
+}
+
+// CWOP is the Citizen Weather Observer Program, over APRS-IS
+type CWOP struct {
+	Enabled bool `yaml:"enabled" env:"WEATHER_CWOP_ENABLED"`
+	// the CWOP id (eg EW1234) or an amateur radio call sign
+	Callsign string `yaml:"callsign" env:"WEATHER_CWOP_CALLSIGN"`
+	// -1 for a CWOP id, ham stations use the passcode for their call
+	Passcode string `yaml:"passcode" env:"WEATHER_CWOP_PASSCODE"`
+	Server   string `yaml:"server" env:"WEATHER_CWOP_SERVER"`
+	// how often they get an observation, at least 5 and must divide into an hour
+	FreqMin int `yaml:"freq_min" env:"WEATHER_CWOP_FREQ_MIN"`
+}
+
+type Windy struct {
+	Enabled bool   `yaml:"enabled" env:"WEATHER_WINDY_ENABLED"`
+	APIKey  string `yaml:"api_key" env:"WEATHER_WINDY_API_KEY"`
+	// how often they get an observation, at least 5 and must divide into an hour
+	FreqMin int `yaml:"freq_min" env:"WEATHER_WINDY_FREQ_MIN"`
+	// the station details windy shows, the position and elevation come from station
+	StationID   int     `yaml:"station_id"`
+	Name        string  `yaml:"name"`
+	ShareOption string  `yaml:"share_option"`
+	TempHeight  float64 `yaml:"temp_height"` // metres above the ground
+	WindHeight  float64 `yaml:"wind_height"`
+}
+
+type Reporting struct {
+	// how often the db gets a record, must divide into an hour
+	FreqMin int `yaml:"freq_min" env:"WEATHER_REPORT_FREQ_MIN"`
+}
+
+type Sensors struct {
+	I2CBus       string     `yaml:"i2c_bus" env:"WEATHER_I2C_BUS"`
+	HeartbeatLed string     `yaml:"heartbeat_led"`
+	Atmosphere   Atmosphere `yaml:"atmosphere"`
+	Rain         Rain       `yaml:"rain"`
+	Wind         Wind       `yaml:"wind"`
+}
+
+type Atmosphere struct {
+	Enabled bool   `yaml:"enabled"`
+	MCP9808 uint16 `yaml:"mcp9808_address"`
+	BME280  uint16 `yaml:"bme280_address"`
+}
+
+type Rain struct {
+	Enabled  bool    `yaml:"enabled"`
+	Pin      string  `yaml:"pin"`
+	TipLed   string  `yaml:"tip_led"`
+	MmPerTip float64 `yaml:"mm_per_tip"`
+}
+
+type Wind struct {
+	Enabled    bool    `yaml:"enabled"`
+	Masthead   uint16  `yaml:"masthead_address"`
+	ADC        uint16  `yaml:"adc_address"`
+	MphPerTick float64 `yaml:"mph_per_tick"`
+	Vane       Vane    `yaml:"vane"`
+	// weight the mean direction by the speed, so gusts count for more and calm is ignored
+	SpeedWeightedDirection bool `yaml:"speed_weighted_direction"`
+	// averaging windows, WMO is a 2 minute mean for now, a 10 minute mean for
+	// reports and the highest 3 second mean in 10 minutes for the gust
+	MeanShortSeconds  int `yaml:"mean_short_seconds"`
+	MeanLongSeconds   int `yaml:"mean_long_seconds"`
+	GustSeconds       int `yaml:"gust_seconds"`
+	GustWindowSeconds int `yaml:"gust_window_seconds"`
+}
+
+// Flags are the command line only switches, mostly for debugging.
+type Flags struct {
+	Test        bool
+	Sim         bool
+	Verbose     bool
+	Speedon     bool
+	Diron       bool
+	Rainon      bool
+	Humidity    bool
+	Record      string
+	Replay      string
+	ReplaySpeed float64
 }
@@ -0,0 +1,107 @@
+package env
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Vane is the wind vane calibration. The vane is a ring of reed switches and
+// resistors so each of the 16 compass points gives a different voltage out of the
+// divider. Either pick a model or give the measured volts for each point in the
+// table (the calibrate-vane command writes one).
+type Vane struct {
+	Model       string      `yaml:"model,omitempty"`        // misol or fineoffset, not used if there is a table
+	SupplyVolts float64     `yaml:"supply_volts,omitempty"` // fineoffset, the divider supply
+	PullupOhms  float64     `yaml:"pullup_ohms,omitempty"`  // fineoffset, the fixed resistor in the divider
+	Offset      float64     `yaml:"offset,omitempty"`       // degrees added to the reading, for a mast not lined up on true north
+	Table       []VanePoint `yaml:"table,omitempty"`
+}
+
+type VanePoint struct {
+	Degrees float64 `yaml:"degrees"`
+	Volts   float64 `yaml:"volts"`
+}
+
+// misol is my vane. The original thresholds came from measuring each point and
+// going midway between neighbours, these volts give exactly those thresholds.
+var misol = []VanePoint{
+	{112.5, 0.343},
+	{67.5, 0.409},
+	{90, 0.473},
+	{157.5, 0.623},
+	{135, 0.927},
+	{202.5, 1.211},
+	{180, 1.437},
+	{22.5, 2.015},
+	{45, 2.307},
+	{247.5, 2.973},
+	{225, 3.137},
+	{337.5, 3.493},
+	{0, 3.917},
+	{292.5, 4.109},
+	{315, 4.407},
+	{270, 4.693},
+}
+
+// fineoffset is the vane resistance for each point from the datasheet (doc/DS-15901-Weather_Meter.pdf)
+var fineoffset = map[float64]float64{
+	0:     33000,
+	22.5:  6570,
+	45:    8200,
+	67.5:  891,
+	90:    1000,
+	112.5: 688,
+	135:   2200,
+	157.5: 1410,
+	180:   3900,
+	202.5: 3140,
+	225:   16000,
+	247.5: 14120,
+	270:   120000,
+	292.5: 42120,
+	315:   64900,
+	337.5: 21880,
+}
+
+// Points checks the calibration and returns the table sorted by volts.
+func (v Vane) Points() ([]VanePoint, error) {
+	var points []VanePoint
+	switch {
+	case len(v.Table) > 0:
+		points = append(points, v.Table...)
+	case v.Model == "misol":
+		points = append(points, misol...)
+	case v.Model == "fineoffset":
+		if v.SupplyVolts <= 0 || v.PullupOhms <= 0 {
+			return nil, fmt.Errorf("sensors.wind.vane fineoffset needs supply_volts and pullup_ohms")
+		}
+		for deg, ohms := range fineoffset {
+			points = append(points, VanePoint{Degrees: deg, Volts: v.SupplyVolts * ohms / (ohms + v.PullupOhms)})
+		}
+	default:
+		return nil, fmt.Errorf("sensors.wind.vane.model [%v] should be misol or fineoffset, or give a table", v.Model)
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Volts < points[j].Volts })
+	seen := map[float64]bool{}
+	for i, p := range points {
+		if p.Degrees < 0 || p.Degrees >= 360 {
+			return nil, fmt.Errorf("sensors.wind.vane.table degrees [%v] should be 0 to 360", p.Degrees)
+		}
+		if seen[p.Degrees] {
+			return nil, fmt.Errorf("sensors.wind.vane.table has [%v] degrees more than once", p.Degrees)
+		}
+		seen[p.Degrees] = true
+		if i > 0 && p.Volts == points[i-1].Volts {
+			return nil, fmt.Errorf("sensors.wind.vane.table [%v] and [%v] degrees are both [%v] volts", points[i-1].Degrees, p.Degrees, p.Volts)
+		}
+	}
+	if len(points) < 4 {
+		return nil, fmt.Errorf("sensors.wind.vane.table only has [%v] points", len(points))
+	}
+	if math.Abs(v.Offset) > 360 {
+		return nil, fmt.Errorf("sensors.wind.vane.offset [%v] should be -360 to 360", v.Offset)
+	}
+	return points, nil
+}
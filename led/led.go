@@ -15,7 +15,8 @@ type LED struct {
 	lock    *sync.Mutex
 	on      bool
 	blink   chan bool
-	Close   chan bool
+	done    chan struct{}
+	closed  sync.Once
 	gpioPin gpio.PinIO
 }
 
@@ -26,11 +27,13 @@ func NewLED(name string, GPIOPin string) *LED {
 		lock:  &sync.Mutex{},
 		on:    false,
 		blink: make(chan bool),
+		done:  make(chan struct{}),
 	}
 	l.gpioPin = gpioreg.ByName(GPIOPin)
 	if l.gpioPin == nil {
+		// no pi (or no such pin), the LED just does nothing
 		logger.Errorf("Failed to find %v pin", GPIOPin)
-
+		return l
 	}
 
 	// flicker to show it's working
@@ -52,8 +55,7 @@ func NewLED(name string, GPIOPin string) *LED {
 			select {
 			case <-l.blink:
 				l.Flash()
-			case <-l.Close:
-				l.Off()
+			case <-l.done:
 				return
 			}
 		}
@@ -61,6 +63,12 @@ func NewLED(name string, GPIOPin string) *LED {
 	return l
 }
 
+// Close turns the LED off for good
+func (l *LED) Close() {
+	l.closed.Do(func() { close(l.done) })
+	l.Off()
+}
+
 func (l *LED) On() {
 	l.lock.Lock()
 	defer l.lock.Unlock()
@@ -0,0 +1,188 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+Pushes the observations to whoever is listening, as Server-Sent Events or over
+a WebSocket, so a display doesn't have to poll.
+
+Publish never waits for a client. Each one has a small buffer and a client
+that lets it fill up (a stalled connection, a phone gone to sleep) is dropped,
+an EventSource reconnects by itself and starts again from the next message.
+*/
+
+// each client can be this many messages behind before it's dropped
+const bufferSize = 16
+
+// ping an idle connection so proxies don't close it and dead ones are noticed
+const pingPeriod = 30 * time.Second
+
+// Message is one event, Data is JSON
+type Message struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Hub sends every message to every subscriber
+type Hub struct {
+	lock sync.Mutex
+	subs map[chan Message]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[chan Message]struct{}{}}
+}
+
+// Publish sends v as JSON to everyone subscribed
+func (h *Hub) Publish(event string, v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		logger.Errorf("Failed to encode [%v] event [%v]", event, err)
+		return
+	}
+	m := Message{Event: event, Data: js}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for c := range h.subs {
+		select {
+		case c <- m:
+		default:
+			logger.Warnf("Dropping a live client that is [%v] messages behind", bufferSize)
+			delete(h.subs, c)
+			close(c)
+		}
+	}
+}
+
+// Subscribe gives a channel with every message from now on, it is closed if the
+// subscriber falls behind. Call Unsubscribe when done.
+func (h *Hub) Subscribe() chan Message {
+	c := make(chan Message, bufferSize)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.subs[c] = struct{}{}
+	return c
+}
+
+func (h *Hub) Unsubscribe(c chan Message) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, ok := h.subs[c]; ok {
+		delete(h.subs, c)
+		close(c)
+	}
+}
+
+// Len is the number of subscribers
+func (h *Hub) Len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.subs)
+}
+
+// ServeSSE streams the messages as Server-Sent Events
+func (h *Hub) ServeSSE(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	c := h.Subscribe()
+	defer h.Unsubscribe(c)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	// how long the browser waits before reconnecting, ms
+	fmt.Fprint(rw, "retry: 5000\n\n")
+	flusher.Flush()
+
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case m, ok := <-c:
+			if !ok {
+				// too slow, it'll reconnect
+				return
+			}
+			_, err = fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", m.Event, m.Data)
+		case <-ping.C:
+			_, err = fmt.Fprint(rw, ": ping\n\n")
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+var upgrader = websocket.Upgrader{
+	// the weather isn't a secret, let a display served from anywhere connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServeWS streams the messages over a WebSocket, each one is a JSON Message
+func (h *Hub) ServeWS(rw http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		// Upgrade has already replied
+		logger.Warnf("WebSocket upgrade failed [%v]", err)
+		return
+	}
+	defer conn.Close()
+	c := h.Subscribe()
+	defer h.Unsubscribe(c)
+
+	// nothing is expected from the client, but reading is how a close or a dead
+	// connection is noticed
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-gone:
+			return
+		case <-r.Context().Done():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"), time.Now().Add(time.Second))
+			return
+		case m, ok := <-c:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(time.Second))
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err = conn.WriteJSON(m)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package live
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	// nobody listening is fine
+	h.Publish("rain", 1)
+
+	c := h.Subscribe()
+	slow := h.Subscribe()
+	require.Equal(t, 2, h.Len())
+
+	h.Publish("rain", map[string]float64{"rain_day": 0.2})
+	m := <-c
+	require.Equal(t, "rain", m.Event)
+	require.JSONEq(t, `{"rain_day":0.2}`, string(m.Data))
+
+	// slow never reads, once its buffer is full it is dropped and closed
+	for range bufferSize {
+		h.Publish("gust", 1)
+		<-c
+	}
+	require.Equal(t, 1, h.Len())
+	for range bufferSize {
+		<-slow
+	}
+	_, ok := <-slow
+	require.False(t, ok)
+	h.Unsubscribe(slow) // already gone
+
+	h.Unsubscribe(c)
+	require.Equal(t, 0, h.Len())
+}
+
+// waitFor waits for the client to be subscribed, so nothing published is missed
+func waitFor(t *testing.T, h *Hub, n int) {
+	require.Eventually(t, func() bool { return h.Len() == n }, time.Second, time.Millisecond)
+}
+
+func TestSSE(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeSSE))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	waitFor(t, h, 1)
+	h.Publish("observation", map[string]string{"units": "metric"})
+
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if strings.HasPrefix(sc.Text(), "event:") || strings.HasPrefix(sc.Text(), "data:") {
+			lines = append(lines, sc.Text())
+		}
+		if len(lines) == 2 {
+			break
+		}
+	}
+	require.Equal(t, []string{"event: observation", `data: {"units":"metric"}`}, lines)
+
+	// the client going away unsubscribes it
+	resp.Body.Close()
+	waitFor(t, h, 0)
+}
+
+func TestWebSocket(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWS))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	waitFor(t, h, 1)
+	h.Publish("gust", map[string]float64{"wind_gust": 20})
+
+	var m Message
+	require.NoError(t, conn.ReadJSON(&m))
+	require.Equal(t, "gust", m.Event)
+	require.JSONEq(t, `{"wind_gust":20}`, string(m.Data))
+
+	conn.Close()
+	waitFor(t, h, 0)
+}
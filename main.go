@@ -1,26 +1,31 @@
 package main
 
 import (
-	// "context"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
-	"fmt"
 	"net"
 	"net/http"
 	"os"
-
-	// "os/signal"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"database/sql"
-
-	_ "github.com/lib/pq"
-
+	"github.com/gr-butler/weather/api"
+	"github.com/gr-butler/weather/dashboard"
 	"github.com/gr-butler/weather/data"
+	"github.com/gr-butler/weather/db"
+	"github.com/gr-butler/weather/db/migrate"
 	"github.com/gr-butler/weather/db/postgres"
 	"github.com/gr-butler/weather/env"
 	"github.com/gr-butler/weather/led"
+	"github.com/gr-butler/weather/live"
+	"github.com/gr-butler/weather/qc"
+	"github.com/gr-butler/weather/queue"
+	"github.com/gr-butler/weather/rollup"
 	"github.com/gr-butler/weather/sensors"
+	"github.com/gr-butler/weather/upload"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
@@ -33,37 +38,38 @@ const version = "GRB-Weather-2.2.0"
 
 // 2.2.0 added mqtt
 
-const (
-	host     = "server.internal"
-	port     = 5432
-	user     = "weather"
-	password = "weather01."
-	dbname   = "weather"
-	broker   = "tcp://server.internal:1883"
-	clientID = "weather-mqtt-client"
-	topic    = "culverhay/weather"
-)
-
 type weatherstation struct {
 	client       mqtt.Client
 	s            *sensors.Sensors
 	data         *data.WeatherData
-	Db           *postgres.Queries
+	Db           postgres.Querier
+	dbQueue      *queue.Queue[postgres.WriteRecordParams]
 	HeartbeatLed *led.LED
-	args         *env.Args
+	cfg          *env.Config
+	qc           *qc.Checker
+	rollups      *rollup.Roller
+	dbKick       chan struct{} // there's something in dbQueue
+	dbDone       chan struct{} // closed when dbWriter stops
+	snapshot     data.Latest
+	api          *api.Server
+	hub          *live.Hub
+	uploads      *upload.Manager
 }
 
 type webdata struct {
-	TimeNow   string  `json:"time"`
-	TempHiRes float64 `json:"hiResTemp_C"`
-	Humidity  float64 `json:"humidity_RH"`
-	Pressure  float64 `json:"pressure_hPa"`
-	RainHr    float64 `json:"rain_mm_hr"`
-	RainRate  float64 `json:"rain_rate"`
-	RainDay   float64 `json:"rain_day"`
-	WindDir   float64 `json:"wind_dir"`
-	WindSpeed float64 `json:"wind_speed"`
-	WindGust  float64 `json:"wind_gust"`
+	TimeNow   string   `json:"time"`
+	TempHiRes *float64 `json:"hiResTemp_C,omitempty"`
+	Humidity  *float64 `json:"humidity_RH,omitempty"`
+	Pressure  *float64 `json:"pressure_hPa,omitempty"`
+	RainHr    float64  `json:"rain_mm_hr"`
+	RainRate  float64  `json:"rain_rate"`
+	RainDay   float64  `json:"rain_day"`
+	WindDir   float64  `json:"wind_dir"`
+	WindDirSD float64  `json:"wind_dir_sd"`
+	WindSpeed float64  `json:"wind_speed"`
+	WindMean  float64  `json:"wind_speed_10m"`
+	WindGust  float64  `json:"wind_gust"`
+	GustDir   float64  `json:"wind_gust_dir"`
 }
 
 var Prom_atmPresure = prometheus.NewGauge(
@@ -108,10 +114,24 @@ var Prom_windspeed = prometheus.NewGauge(
 	},
 )
 
+var Prom_windspeed10m = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "windspeed_10m",
+		Help: "10 minute average Wind Speed mph",
+	},
+)
+
 var Prom_windgust = prometheus.NewGauge(
 	prometheus.GaugeOpts{
 		Name: "windgust",
-		Help: "Instant wind speed mph",
+		Help: "Highest 3 second wind speed in the last 10 minutes mph",
+	},
+)
+
+var Prom_windgustDirection = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "windgustdirection",
+		Help: "Wind Gust Direction Deg",
 	},
 )
 
@@ -122,6 +142,28 @@ var Prom_windDirection = prometheus.NewGauge(
 	},
 )
 
+var Prom_windDirectionSD = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "winddirection_sd",
+		Help: "Wind Direction std dev Deg (Yamartino)",
+	},
+)
+
+var Prom_quality = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "observation_quality",
+		Help: "QC flag of the last observation, 0 good, 1 suspect, 2 bad, 3 missing",
+	},
+	[]string{"reading"},
+)
+
+var Prom_dbQueueDepth = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "db_queue_depth",
+		Help: "Records waiting to be written to the db",
+	},
+)
+
 var connectHandler mqtt.OnConnectHandler = func(client mqtt.Client) {
 	logger.Info("Connected to MQTT Broker")
 }
@@ -148,8 +190,13 @@ func init() {
 		Prom_rainDayTotal,
 		Prom_temperature,
 		Prom_windspeed,
+		Prom_windspeed10m,
 		Prom_windgust,
-		Prom_windDirection)
+		Prom_windgustDirection,
+		Prom_windDirection,
+		Prom_windDirectionSD,
+		Prom_quality,
+		Prom_dbQueueDepth)
 }
 
 // Get preferred outbound ip of this machine
@@ -166,70 +213,174 @@ func GetOutboundIP() net.IP {
 	return localAddr.IP
 }
 
+const defaultConfigFile = "/etc/weather/weather.yaml"
+
 func main() {
 	logger.Infof("Starting weather station [%v]", version)
 	w := weatherstation{}
-	w.args = &env.Args{}
-
-	w.args.Test = flag.Bool("test", false, "runs in test mode")
-	w.args.NoWow = flag.Bool("nowow", false, "does not send met office data")
-	w.args.Verbose = flag.Bool("v", false, "verbose logging")
-	w.args.Speedon = flag.Bool("speed", false, "show wind speed info")
-	w.args.Diron = flag.Bool("dir", false, "show wind direction")
-	w.args.Rainon = flag.Bool("rain", false, "show rain tip info")
-	w.args.WindEnabled = flag.Bool("windOn", true, "disables the anemometer")
-	w.args.AtmosphericEnabled = flag.Bool("atmOn", true, "disables atmospheric sensor")
-	w.args.RainEnabled = flag.Bool("rainOn", true, "disables rain sensor")
-	w.args.Humidity = flag.Bool("humOn", false, "Debug log raw humidity")
-	flag.Parse()
 
-	wowsiteid, idok := os.LookupEnv("WOWSITEID")
-	wowpin, pinok := os.LookupEnv("WOWPIN")
-	if !idok || !pinok {
+	cfg, err := loadConfig()
+	if flag.Arg(0) == "calibrate-vane" && cfg != nil {
+		// the rest of the config doesn't matter for this, nor does a bad vane table
+		if err := calibrateVane(cfg, flag.Args()[1:]); err != nil {
+			logger.Errorf("Vane calibration failed [%v]", err)
+			logger.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		logger.Errorf("Bad configuration:\n%v", err)
+		logger.Exit(1)
+	}
+	w.cfg = cfg
+
+	// SIGINT or SIGTERM cancels ctx, everything running in the background stops on it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if w.cfg.Wow.Enabled && (w.cfg.Wow.SiteID == "" || w.cfg.Wow.Pin == "") {
 		logger.Warn("Missing WOW details")
-		w.args.NoWow = &env.Enabled
+		w.cfg.Wow.Enabled = false
+	}
+	if w.cfg.WU.Enabled && (w.cfg.WU.StationID == "" || w.cfg.WU.Key == "") {
+		logger.Warn("Missing Weather Underground details")
+		w.cfg.WU.Enabled = false
+	}
+	if w.cfg.CWOP.Enabled && w.cfg.CWOP.Callsign == "" {
+		logger.Warn("Missing CWOP callsign")
+		w.cfg.CWOP.Enabled = false
+	}
+	if w.cfg.Windy.Enabled && w.cfg.Windy.APIKey == "" {
+		logger.Warn("Missing windy API key")
+		w.cfg.Windy.Enabled = false
 	}
-	w.args.WowPin = wowpin
-	w.args.WowSiteID = wowsiteid
 
-	if *w.args.Test {
+	if w.cfg.Flags.Test {
 		logger.Info("TEST MODE")
 	}
+	if w.cfg.Flags.Sim {
+		logger.Info("SIMULATION MODE")
+	}
+	if w.cfg.Flags.Replay != "" {
+		// never send a replay to the met office (or anyone else)
+		logger.Info("REPLAY MODE")
+		w.cfg.Wow.Enabled = false
+		w.cfg.WU.Enabled = false
+		w.cfg.CWOP.Enabled = false
+		w.cfg.Windy.Enabled = false
+	}
 
 	// connect to database
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
-
-	db, err := sql.Open("postgres", psqlInfo)
+	store, err := db.Open(w.cfg.Database)
 	if err != nil {
 		logger.Errorf("Failed to initialise database: [%v]", err)
 		logger.Exit(1)
 	}
-	defer db.Close()
+	defer store.Close()
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(store, flag.Arg(1)); err != nil {
+			logger.Errorf("Migration failed [%v]", err)
+			logger.Exit(1)
+		}
+		return
+	}
+
+	if w.cfg.Flags.Replay == "" {
+		err := checkSchema(store)
+		switch {
+		case errors.Is(err, migrate.ErrWrongVersion):
+			logger.Errorf("Database schema problem [%v]", err)
+			logger.Exit(1)
+		case err != nil:
+			// the db might just be down, carry on and the writes will fail
+			logger.Warnf("Unable to check the database schema [%v]", err)
+		default:
+			logger.Infof("Successfully connected to [%v] db.", w.cfg.Database.Driver)
+		}
+	}
 
-	logger.Info("Successfully connected to db.")
+	if flag.Arg(0) == "rollup" {
+		if err := runRollup(store, flag.Arg(1)); err != nil {
+			logger.Errorf("Rollup failed [%v]", err)
+			logger.Exit(1)
+		}
+		return
+	}
 
-	w.Db = postgres.New(db)
+	w.Db = store
+	w.rollups = rollup.New(store, time.Local)
+	w.dbQueue, err = queue.Open[postgres.WriteRecordParams](w.cfg.Database.QueueFile)
+	if err != nil {
+		logger.Errorf("Failed to open the db queue [%v]", err)
+		logger.Exit(1)
+	}
+	if n := w.dbQueue.Len(); n > 0 {
+		logger.Infof("[%v] db records waiting to be written", n)
+	}
+	Prom_dbQueueDepth.Set(float64(w.dbQueue.Len()))
+	w.dbKick = make(chan struct{}, 1)
+	w.dbDone = make(chan struct{})
+	// catch up with anything left from last time
+	w.dbKick <- struct{}{}
+	go w.dbWriter(ctx)
 
 	logger.Info("Initializing sensors...")
 
-	w.s = sensors.InitSensors(w.args)
-	if w.s == nil {
-		logger.Error("Failed to initialise sensors")
+	hw, err := w.openHardware()
+	if err != nil {
+		logger.Errorf("Failed to initialise sensors [%v]", err)
 		logger.Exit(1)
 	}
-	defer (*w.s.Closer).Close()
+	w.s = sensors.NewSensors(ctx, hw, w.cfg)
+	logger.Infof("Sensors available %+v", w.s.Available())
 
 	//setup heartbeat
-	w.HeartbeatLed = led.NewLED("Heartbeat LED", env.HeartbeatLed)
-	go w.Heartbeat()
+	w.HeartbeatLed = led.NewLED("Heartbeat LED", w.cfg.Sensors.HeartbeatLed)
+	go w.Heartbeat(ctx)
 
 	w.data = data.CreateWeatherData()
+	w.qc = qc.NewChecker()
+
+	station := api.Station{
+		ID:        w.cfg.Station.ID,
+		Latitude:  w.cfg.Station.Latitude,
+		Longitude: w.cfg.Station.Longitude,
+		AltitudeM: w.cfg.Station.Altitude,
+		Software:  version,
+	}
+	w.api = api.New(w.Db, time.Local, station, w.latest)
+	w.startStream()
+
+	w.uploads = upload.NewManager(uploadStatePath)
+	if w.cfg.Wow.Enabled {
+		// WOW takes old observations, so the ones that fail wait and go later
+		wow := upload.NewWOW(w.cfg.Wow, version)
+		if err := w.uploads.AddQueued(wow, w.cfg.Wow.QueueFile); err != nil {
+			logger.Errorf("Failed to open the WOW queue [%v], failed uploads won't be sent later [%v]", w.cfg.Wow.QueueFile, err)
+			w.uploads.Add(wow)
+		}
+	}
+	if w.cfg.WU.Enabled {
+		w.uploads.Add(upload.NewWU(w.cfg.WU, version))
+	}
+	if w.cfg.CWOP.Enabled {
+		w.uploads.Add(upload.NewCWOP(w.cfg.CWOP, w.cfg.Station, version))
+	}
+	if w.cfg.Windy.Enabled {
+		w.uploads.Add(upload.NewWindy(w.cfg.Windy, w.cfg.Station))
+	}
+	w.uploads.Start(ctx)
 
-	go w.Reporting()
+	reporting := make(chan struct{})
+	go func() {
+		defer close(reporting)
+		w.Reporting(ctx)
+	}()
 
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(broker)
-	opts.SetClientID(clientID)
+	opts.AddBroker(w.cfg.MQTT.Broker)
+	opts.SetClientID(w.cfg.MQTT.ClientID)
 	opts.SetKeepAlive(30)
 	opts.SetPingTimeout(10 * time.Second)
 	opts.AutoReconnect = true
@@ -245,35 +396,174 @@ func main() {
 	logger.Infof("[%v] Starting webservice...", version)
 	http.HandleFunc("/", w.handler)
 	http.Handle("/metrics", promhttp.Handler())
+	w.api.Register(http.DefaultServeMux)
+	http.HandleFunc("GET /api/v1/stream", w.hub.ServeSSE)
+	http.HandleFunc("GET /api/v1/stream/ws", w.hub.ServeWS)
+	dashboard.Register(http.DefaultServeMux)
+
+	srv := &http.Server{
+		Addr: w.cfg.HTTP.Listen,
+		// so the live streams end on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Web server failed [%v]", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	w.shutdown(srv, reporting)
+	logger.Info("Exiting...")
+}
 
-	logger.Info(http.ListenAndServe(":80", nil))
-	w.HeartbeatLed.Off()
-	w.s.Rain.GetLED().Off()
-	defer logger.Info("Exiting...")
+const (
+	// how long shutting down can take before we stop waiting
+	shutdownTimeout = 15 * time.Second
+	// how long the last observation has to be saved, leaving time to close everything else
+	finishTimeout = 10 * time.Second
+)
+
+// shutdown waits for the last observation to be saved then stops everything else
+func (w *weatherstation) shutdown(srv *http.Server, reporting <-chan struct{}) {
+	logger.Info("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warnf("Web server didn't stop cleanly [%v]", err)
+	}
+	select {
+	case <-reporting:
+	case <-ctx.Done():
+		logger.Warn("Timed out waiting for the last observation to be saved")
+	}
+	w.client.Disconnect(250)
+	if err := w.s.Close(); err != nil {
+		logger.Errorf("Failed to close the sensors [%v]", err)
+	}
+	w.HeartbeatLed.Close()
 }
 
-func (w *weatherstation) Heartbeat() {
+// loadConfig reads the config file and lets the command line override it
+func loadConfig() (*env.Config, error) {
+	configFile := flag.String("config", defaultConfigFile, "config file")
+	flags := env.Flags{}
+	flag.BoolVar(&flags.Test, "test", false, "runs in test mode")
+	flag.BoolVar(&flags.Sim, "sim", false, "uses simulated sensors instead of the pi hardware")
+	flag.StringVar(&flags.Record, "record", "", "records raw sensor samples to this file")
+	flag.StringVar(&flags.Replay, "replay", "", "replays raw sensor samples from this file instead of the pi hardware")
+	flag.Float64Var(&flags.ReplaySpeed, "replayspeed", 1, "how many times faster than real time to replay")
+	flag.BoolVar(&flags.Verbose, "v", false, "verbose logging")
+	flag.BoolVar(&flags.Speedon, "speed", false, "show wind speed info")
+	flag.BoolVar(&flags.Diron, "dir", false, "show wind direction")
+	flag.BoolVar(&flags.Rainon, "rain", false, "show rain tip info")
+	flag.BoolVar(&flags.Humidity, "humOn", false, "Debug log raw humidity")
+	noWow := flag.Bool("nowow", false, "does not send met office data")
+	windOn := flag.Bool("windOn", true, "disables the anemometer")
+	atmOn := flag.Bool("atmOn", true, "disables atmospheric sensor")
+	rainOn := flag.Bool("rainOn", true, "disables rain sensor")
+	flag.Parse()
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	path := *configFile
+	if _, err := os.Stat(path); os.IsNotExist(err) && !set["config"] {
+		logger.Warnf("No config file [%v], using the defaults", path)
+		path = ""
+	}
+	cfg, err := env.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		logger.Infof("Loaded config [%v]", path)
+	}
+
+	cfg.Flags = flags
+	// the sensor and wow switches are in the config file too, only override if given
+	if *noWow {
+		cfg.Wow.Enabled = false
+	}
+	if set["windOn"] {
+		cfg.Sensors.Wind.Enabled = *windOn
+	}
+	if set["atmOn"] {
+		cfg.Sensors.Atmosphere.Enabled = *atmOn
+	}
+	if set["rainOn"] {
+		cfg.Sensors.Rain.Enabled = *rainOn
+	}
+	return cfg, cfg.Validate()
+}
+
+// the sensors come from the pi, the simulator or a recording
+func (w *weatherstation) openHardware() (*sensors.Hardware, error) {
+	var hw *sensors.Hardware
+	var err error
+	switch {
+	case w.cfg.Flags.Replay != "":
+		hw, err = sensors.ReplayHardware(w.cfg.Flags.Replay, w.cfg.Flags.ReplaySpeed, w.cfg)
+	case w.cfg.Flags.Sim:
+		hw = sensors.SimulatedHardware(w.cfg)
+	default:
+		hw, err = sensors.OpenHardware(w.cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if w.cfg.Flags.Record != "" {
+		return hw.Record(w.cfg.Flags.Record)
+	}
+	return hw, nil
+}
+
+func (w *weatherstation) Heartbeat(ctx context.Context) {
 	logger.Info("Heartbeat started")
 	for {
 		w.HeartbeatLed.Flash()
-		time.Sleep(time.Second * 60)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
 	}
 }
 
+// handler is the original json, from the latest snapshot
 func (w *weatherstation) handler(rw http.ResponseWriter, r *http.Request) {
+	s, ok := w.snapshot.Get()
+	if !ok {
+		http.Error(rw, "no observation yet", http.StatusServiceUnavailable)
+		return
+	}
 	rw.Header().Set("Content-Type", "application/json")
-	pres, hum := w.s.Atm.GetHumidityAndPressure()
+	// the time the sensors were read
 	wd := webdata{
-		TempHiRes: w.s.Atm.GetTemperature().Float64(),
-		Humidity:  hum.Float64(),
-		Pressure:  pres.Float64(),
-		RainHr:    w.s.Rain.GetRate().Float64(),
-		RainDay:   w.s.Rain.GetDayAccumulation().Float64(),
-		TimeNow:   time.Now().Format(time.RFC822),
-		WindDir:   w.s.Wind.GetDirection(),
-		WindSpeed: w.s.Wind.GetSpeed(),
-		WindGust:  w.s.Wind.GetGust(),
+		TimeNow: s.Time.UTC().Format(time.RFC822),
+	}
+	// leave out anything that didn't read rather than show 0
+	if s.TemperatureC.Usable() {
+		wd.TempHiRes = value(s.TemperatureC.Value)
+	}
+	if s.Humidity.Usable() {
+		wd.Humidity = value(s.Humidity.Value)
+	}
+	if s.PressureHpa.Usable() {
+		wd.Pressure = value(s.PressureHpa.Value)
 	}
+	wd.RainHr = orZero(s.RainRate)
+	if s.RainDayMM != nil {
+		wd.RainDay = *s.RainDayMM
+	}
+	wd.WindDir = orZero(s.WindDirNow)
+	wd.WindDirSD = orZero(s.WindDirSD)
+	wd.WindSpeed = orZero(s.WindSpeedNow)
+	wd.WindMean = orZero(s.WindSpeed)
+	wd.WindGust = orZero(s.WindGust)
+	wd.GustDir = orZero(s.WindGustDir)
 
 	js, err := json.Marshal(wd)
 	if err != nil {
@@ -286,18 +576,10 @@ func (w *weatherstation) handler(rw http.ResponseWriter, r *http.Request) {
 	_, _ = rw.Write(js) // not much we can do if this fails
 }
 
-// GetInterruptContext gives a context that will call cancel() when an os.Interupt is signalled
-// func getInterruptContext() context.Context {
-// 	ctx, cancel := context.WithCancel(context.Background())
-
-// 	sigChan := make(chan os.Signal, 1)
-// 	signal.Notify(sigChan, os.Interrupt)
-
-// 	go func() {
-// 		<-sigChan
-// 		logger.Info("SIGTERM received, stopping...")
-// 		cancel()
-// 	}()
-
-// 	return ctx
-// }
+// the old format has 0 for anything missing
+func orZero(r data.Reading) float64 {
+	if !r.Usable() {
+		return 0
+	}
+	return r.Value
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gr-butler/weather/db"
+	"github.com/gr-butler/weather/rollup"
+	logger "github.com/sirupsen/logrus"
+)
+
+// runMigrate is the migrate command
+//
+//	weather migrate up|down|status
+func runMigrate(store db.Storage, cmd string) error {
+	m, err := store.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch cmd {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, mig := range done {
+			logger.Infof("Applied migration [%v %v]", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			logger.Infof("Already at version [%v]", m.Latest())
+		}
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if mig == nil {
+			logger.Info("Nothing to undo")
+		} else {
+			logger.Infof("Undid migration [%v %v]", mig.Version, mig.Name)
+		}
+	case "status", "":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%04d\t%v\t%v\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command [%v], use up, down or status", cmd)
+	}
+	return nil
+}
+
+// runRollup is the rollup command, it works out the hourly, daily and monthly
+// rollups again from the records, from the given month or the first record
+//
+//	weather rollup [2006-01]
+func runRollup(store db.Storage, from string) error {
+	var start time.Time
+	if from != "" {
+		var err error
+		start, err = time.ParseInLocation("2006-01", from, time.Local)
+		if err != nil {
+			return fmt.Errorf("unknown month [%v], use 2006-01", from)
+		}
+		// midday, before 09:00 on the 1st is still the month before
+		start = start.Add(12 * time.Hour)
+	}
+	months, err := rollup.New(store, time.Local).Backfill(context.Background(), start, time.Now())
+	logger.Infof("Rolled up [%v] months", months)
+	return err
+}
+
+// checkSchema stops the station running against a db it would write the wrong columns to
+func checkSchema(store db.Storage) error {
+	m, err := store.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return m.Check(ctx)
+}
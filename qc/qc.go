@@ -0,0 +1,150 @@
+package qc
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gr-butler/weather/data"
+)
+
+/*
+Quality control, loosely following the WMO guide (WMO-No. 8) and what the Met
+Office do with WOW data. Each observation goes through
+
+  range        is it physically possible here (UK, mph, hPa at the station)
+  step         has it changed faster than the weather can, usually a spike
+  persistence  has it not changed for so long the sensor is probably stuck
+  consistency  do the readings agree with each other
+
+Range and step failures are Bad and withheld, persistence and consistency
+failures are Suspect, published but flagged.
+*/
+
+type limit struct {
+	min, max float64
+	step     float64       // the most it can change in a minute, 0 to skip
+	stuck    time.Duration // suspect if it hasn't changed in this long, 0 to skip
+	angle    bool          // degrees, 359 to 1 is a step of 2
+	// don't count it as stuck if this is true, eg 100% humidity in fog
+	allowStuck func(o *data.Observation) bool
+}
+
+// MaxWindMph is the fastest wind believable at the station, anything faster is interference or switch bounce
+const MaxWindMph = 120
+
+var limits = map[string]limit{
+	"temperature": {min: -30, max: 45, step: 3, stuck: 2 * time.Hour},
+	"humidity": {min: 1, max: 100, step: 15, stuck: 6 * time.Hour,
+		allowStuck: func(o *data.Observation) bool { return o.Humidity.Value >= 98 }},
+	"pressure":   {min: 870, max: 1085, step: 1, stuck: 4 * time.Hour},
+	"rain":       {min: 0, max: 10},
+	"rain_rate":  {min: 0, max: 500},
+	"wind_speed": {min: 0, max: MaxWindMph, step: 40},
+	"wind_direction": {min: 0, max: 360, angle: true, stuck: 2 * time.Hour,
+		allowStuck: func(o *data.Observation) bool { return o.WindSpeed.Value < 2 }},
+	"wind_gust":     {min: 0, max: MaxWindMph * 1.5},
+	"wind_gust_dir": {min: 0, max: 360, angle: true},
+}
+
+// a step from a reading older than this isn't checked, the sensor may have been off
+const stepMaxAge = 10 * time.Minute
+
+type history struct {
+	value   float64
+	at      time.Time // last usable reading
+	changed time.Time // when it last changed
+}
+
+// Checker keeps what it needs of the previous observations for the step and persistence checks.
+type Checker struct {
+	last map[string]*history
+}
+
+func NewChecker() *Checker {
+	return &Checker{last: map[string]*history{}}
+}
+
+// Check flags every reading in o. Readings that are already Missing are left alone.
+func (c *Checker) Check(o *data.Observation, now time.Time) {
+	readings := o.Readings()
+	for name, r := range readings {
+		if r.Quality == data.Missing {
+			continue
+		}
+		c.check(name, r, o, now)
+	}
+	consistency(o)
+	for name, r := range readings {
+		if r.Usable() {
+			c.remember(name, r.Value, now)
+		}
+	}
+}
+
+func (c *Checker) check(name string, r *data.Reading, o *data.Observation, now time.Time) {
+	l, ok := limits[name]
+	if !ok {
+		return
+	}
+	if math.IsNaN(r.Value) || r.Value < l.min || r.Value > l.max {
+		r.Flag(data.Bad, fmt.Sprintf("range %v to %v", l.min, l.max))
+		return
+	}
+	h := c.last[name]
+	if h == nil {
+		return
+	}
+	if l.step > 0 && now.Sub(h.at) <= stepMaxAge && now.After(h.at) {
+		diff := math.Abs(r.Value - h.value)
+		if l.angle {
+			diff = math.Min(diff, 360-diff)
+		}
+		// observations are a minute apart, faster in test mode
+		if diff/math.Max(now.Sub(h.at).Minutes(), 1) > l.step {
+			r.Flag(data.Bad, fmt.Sprintf("step %.1f from %.1f", r.Value-h.value, h.value))
+			return
+		}
+	}
+	if l.stuck > 0 && r.Value == h.value && now.Sub(h.changed) > l.stuck {
+		if l.allowStuck == nil || !l.allowStuck(o) {
+			r.Flag(data.Suspect, fmt.Sprintf("stuck since %v", h.changed.Format(time.RFC3339)))
+		}
+	}
+}
+
+func (c *Checker) remember(name string, v float64, now time.Time) {
+	h := c.last[name]
+	if h == nil {
+		c.last[name] = &history{value: v, at: now, changed: now}
+		return
+	}
+	if v != h.value {
+		h.changed = now
+	}
+	h.value = v
+	h.at = now
+}
+
+// consistency checks the readings against each other
+func consistency(o *data.Observation) {
+	if o.WindGust.Usable() && o.WindSpeed.Usable() && o.WindGust.Value < o.WindSpeed.Value {
+		o.WindGust.Flag(data.Suspect, "gust below the mean speed")
+	}
+	if !o.WindSpeed.Usable() {
+		// the directions come from the same mast
+		if o.WindDir.Quality != data.Missing {
+			o.WindDir.Flag(data.Bad, "wind speed is "+o.WindSpeed.Quality.String())
+		}
+		if o.WindGustDir.Quality != data.Missing {
+			o.WindGustDir.Flag(data.Bad, "wind speed is "+o.WindSpeed.Quality.String())
+		}
+	}
+	if !o.WindGust.Usable() && o.WindGustDir.Quality != data.Missing {
+		o.WindGustDir.Flag(data.Bad, "wind gust is "+o.WindGust.Quality.String())
+	}
+	if o.RainMM.Usable() && o.RainMM.Value > 0 && o.Humidity.Usable() && o.Humidity.Value < 40 {
+		// spiders, birds or someone with a watering can
+		o.RainMM.Flag(data.Suspect, "rain at low humidity")
+	}
+}
@@ -0,0 +1,78 @@
+package qc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/data"
+	"github.com/stretchr/testify/require"
+)
+
+func obs() data.Observation {
+	return data.Observation{
+		TemperatureC: data.Value(12.5),
+		Humidity:     data.Value(80),
+		PressureHpa:  data.Value(1012),
+		RainMM:       data.Value(0),
+		RainRate:     data.Value(0),
+		WindSpeed:    data.Value(8),
+		WindDir:      data.Value(225),
+		WindGust:     data.Value(15),
+		WindGustDir:  data.Value(230),
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := NewChecker()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	o := obs()
+	c.Check(&o, now)
+	for name, r := range o.Readings() {
+		require.Equal(t, data.Good, r.Quality, name)
+	}
+
+	// a failed BME280 read used to give 0 hPa and 0 %
+	o = obs()
+	o.PressureHpa = data.Value(0)
+	o.Humidity = data.NoValue("read failed")
+	c.Check(&o, now.Add(time.Minute))
+	require.Equal(t, data.Bad, o.PressureHpa.Quality)
+	require.Equal(t, data.Missing, o.Humidity.Quality)
+	require.Equal(t, data.Good, o.TemperatureC.Quality)
+
+	// spike
+	o = obs()
+	o.TemperatureC = data.Value(22.5)
+	o.WindDir = data.Value(235) // 225 to 235 is fine
+	c.Check(&o, now.Add(2*time.Minute))
+	require.Equal(t, data.Bad, o.TemperatureC.Quality)
+	require.Equal(t, data.Good, o.WindDir.Quality)
+
+	// gust below the mean and the wind too fast to be real
+	o = obs()
+	o.WindGust = data.Value(5)
+	c.Check(&o, now.Add(3*time.Minute))
+	require.Equal(t, data.Suspect, o.WindGust.Quality)
+	require.True(t, o.WindGust.Usable())
+	o = obs()
+	o.WindSpeed = data.Value(500)
+	c.Check(&o, now.Add(4*time.Minute))
+	require.Equal(t, data.Bad, o.WindSpeed.Quality)
+	require.Equal(t, data.Bad, o.WindDir.Quality)
+}
+
+func TestStuck(t *testing.T) {
+	c := NewChecker()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var o data.Observation
+	for i := 0; i <= 130; i++ {
+		o = obs()
+		o.Humidity = data.Value(100) // fog, allowed to sit at 100%
+		c.Check(&o, now.Add(time.Duration(i)*time.Minute))
+	}
+	require.Equal(t, data.Suspect, o.TemperatureC.Quality)
+	require.Equal(t, data.Suspect, o.WindDir.Quality)
+	require.Equal(t, data.Good, o.Humidity.Quality)
+	require.Equal(t, data.Good, o.WindSpeed.Quality)
+}
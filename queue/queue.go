@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// Queue is a durable first in first out queue, a journal file with one json
+// item per line. Push appends to the file so nothing is lost if the power goes,
+// Drain sends from the front and rewrites the file with whatever is left.
+type Queue[T any] struct {
+	path  string
+	lock  sync.Mutex
+	items []T
+	// only one drain at a time, it doesn't hold lock while sending
+	draining sync.Mutex
+}
+
+// Open loads the queue from path, creating it (and the directory) if needed.
+func Open[T any](path string) (*Queue[T], error) {
+	q := &Queue[T]{path: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	bad := false
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var item T
+		if err := json.Unmarshal(s.Bytes(), &item); err != nil {
+			// most likely the last line, half written when the power went
+			logger.Warnf("Skipping bad queue entry [%v:%v] [%v]", path, line, err)
+			bad = true
+			continue
+		}
+		q.items = append(q.items, item)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if bad {
+		// or the next push is appended to the broken line
+		return q, q.rewrite()
+	}
+	return q, nil
+}
+
+// Len is how many items are waiting
+func (q *Queue[T]) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+// Push adds item to the back of the queue.
+func (q *Queue[T]) Push(item T) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f, err := os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	q.items = append(q.items, item)
+	return nil
+}
+
+// Drain calls send for each item in order, removing it if send succeeds. It
+// stops at the first error and returns how many were sent. The queue isn't
+// locked while sending, so a slow send doesn't hold up Push.
+func (q *Queue[T]) Drain(send func(T) error) (int, error) {
+	q.draining.Lock()
+	defer q.draining.Unlock()
+	q.lock.Lock()
+	items := append([]T(nil), q.items...)
+	q.lock.Unlock()
+
+	sent := 0
+	var sendErr error
+	for _, item := range items {
+		if sendErr = send(item); sendErr != nil {
+			break
+		}
+		sent++
+	}
+	if sent == 0 {
+		return 0, sendErr
+	}
+	// anything pushed while we were sending is still on the end
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.items = q.items[sent:]
+	if err := q.rewrite(); err != nil {
+		return sent, fmt.Errorf("failed to rewrite queue [%w]", err)
+	}
+	return sent, sendErr
+}
+
+// rewrite replaces the file with what's left, via a temp file so a power cut
+// leaves either the old or the new journal
+func (q *Queue[T]) rewrite() error {
+	var buf bytes.Buffer
+	for _, item := range q.items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
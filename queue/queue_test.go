@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	N    int
+	Name string
+}
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "q.jsonl")
+	q, err := Open[record](path)
+	require.NoError(t, err)
+	require.Equal(t, 0, q.Len())
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, q.Push(record{N: i, Name: "r"}))
+	}
+	require.Equal(t, 5, q.Len())
+
+	// the db goes away after 2
+	var got []int
+	sent, err := q.Drain(func(r record) error {
+		if r.N == 3 {
+			return errors.New("down")
+		}
+		got = append(got, r.N)
+		return nil
+	})
+	require.Error(t, err)
+	require.Equal(t, 2, sent)
+	require.Equal(t, []int{1, 2}, got)
+
+	// restart, with a half written line on the end
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"N":6,"Na`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = Open[record](path)
+	require.NoError(t, err)
+	require.Equal(t, 3, q.Len())
+	require.NoError(t, q.Push(record{N: 7}))
+	got = nil
+	sent, err = q.Drain(func(r record) error {
+		got = append(got, r.N)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, sent)
+	require.Equal(t, []int{3, 4, 5, 7}, got)
+
+	q, err = Open[record](path)
+	require.NoError(t, err)
+	require.Equal(t, 0, q.Len())
+}
+
+func TestQueuePushWhileDraining(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "q.jsonl")
+	q, err := Open[record](path)
+	require.NoError(t, err)
+	require.NoError(t, q.Push(record{N: 1}))
+	require.NoError(t, q.Push(record{N: 2}))
+
+	// a slow db, the push mustn't wait for it
+	sending := make(chan struct{})
+	done := make(chan struct{})
+	var sent int
+	go func() {
+		defer close(done)
+		sent, err = q.Drain(func(r record) error {
+			if r.N == 1 {
+				close(sending)
+				time.Sleep(100 * time.Millisecond)
+			}
+			return nil
+		})
+	}()
+	<-sending
+	start := time.Now()
+	require.NoError(t, q.Push(record{N: 3}))
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+	<-done
+	require.NoError(t, err)
+	require.Equal(t, 2, sent)
+
+	// and it's still there, after a restart too
+	require.Equal(t, 1, q.Len())
+	q, err = Open[record](path)
+	require.NoError(t, err)
+	var got []int
+	_, err = q.Drain(func(r record) error {
+		got = append(got, r.N)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{3}, got)
+}
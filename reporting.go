@@ -2,89 +2,51 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"math"
-	"net/http"
 	"os"
 	"time"
 
-	"github.com/google/go-querystring/query"
+	"github.com/gr-butler/weather/api"
+	"github.com/gr-butler/weather/clock"
+	"github.com/gr-butler/weather/data"
 	"github.com/gr-butler/weather/db/postgres"
-	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/upload"
 
 	logger "github.com/sirupsen/logrus"
 )
 
 const Rd = 287.1
-const g = 9.807  // gravity
-const z0 = 24.71 // River aOD is 16.61, river height at 4.1m is level with the road and I'm 3m above that
+const g = 9.807 // gravity
 const kelvin = 273.1
 
-/*
-
-https://wow.metoffice.gov.uk/support/dataformats
-
-Key points:
-
- WOW expects an HTTP request, in the form of either GET or POST, to the following URL. When received, WOW will interpret and validate the information supplied and respond as below.
-
-The URL to send your request to is: http://wow.metoffice.gov.uk/automaticreading? followed by a set of key/value pairs indicating pieces of data.
-
-
- All uploads must contain 4 pieces of mandatory information plus at least 1 piece of weather data.
-
-    Site ID - siteid:
-    The unique numeric id of the site
-    Authentication Key - siteAuthenticationKey:
-    A pin number, chosen by the user to authenticate with WOW.
-    Date - dateutc:
-    Each observation must have a date, in the date encoding specified below.
-    Software Type - softwaretype
-    The name of the software, to identify which piece of software and which version is uploading data
-
-The date must be in the following format: YYYY-mm-DD HH:mm:ss, where ':' is encoded as %3A, and the space is encoded as either '+' or %20. An example,
-valid date would be: 2011-02-29+10%3A32%3A55, for the 2nd of Feb, 2011 at 10:32:55. Note that the time is in 24 hour format. Also note that the date must be adjusted to UTC time
-
-KEY				Description															UNIT
-
-baromin 		Barometric Pressure (see note) 										Inch of Mercury
-dailyrainin 	Accumulated rainfall so far today 									Inches
-dewptf 			Outdoor Dewpoint 													Fahrenheit
-humidity 		Outdoor Humidity 													0-100 %
-rainin 			Accumulated rainfall since the previous observation 				Inches
-soilmoisture 	% Moisture 															0-100 %
-soiltempf 		Soil Temperature (10cm) 											Fahrenheit
-tempf 			Outdoor Temperature 												Fahrenheit
-visibility 		Visibility 															Kilometres
-winddir 		Instantaneous Wind Direction 										Degrees (0-360)
-windspeedmph 	Instantaneous Wind Speed 											Miles per Hour
-windgustdir 	Current Wind Gust Direction (using software specific time period) 	0-360 degrees
-windgustmph 	Current Wind Gust (using software specific time period) 			Miles per Hour
+const dataFilePath = "/tmp/weatherData.json"
 
-*/
-//PressureinHg = 29.92 * ( Pressurehpa / 1013.2) = 0.02953 * Pressurehpa
+// where the uploaders keep their rain totals
+const uploadStatePath = "/tmp/weatherUploads.json"
 
-const baseUrl = "http://wow.metoffice.gov.uk/automaticreading?"
-const dataFilePath = "/tmp/weatherData.json"
+// how long dbWriter waits after the db fails, doubling up to the max
+const (
+	dbRetryDelay    = time.Minute
+	dbMaxRetryDelay = 15 * time.Minute
+)
 
+// weatherData is the latest observation for MQTT and the db, anything that failed QC is nil
 type weatherData struct {
-	SiteId       string  `url:"siteid"`
-	AuthKey      string  `url:"siteAuthenticationKey"`
-	DateString   string  `url:"dateutc"`
-	SoftwareType string  `url:"softwaretype"`
-	PressureHpa  float64 `url:"-"`
-	TempC        float64 `url:"-"`
-	RainMM       float64 `url:"-"`
-	RainDayIn    float64 `url:"dailyrainin"`
-	PressureIn   float64 `url:"baromin"`
-	Humidity     float64 `url:"humidity"`
-	TempF        float64 `url:"tempf"`
-	DewPointF    float64 `url:"dewptf"`
-	RainIn       float64 `url:"rainin"`
-	WindDir      float64 `url:"winddir"`
-	WindSpeedMph float64 `url:"windspeedmph"`
-	WindGustMph  float64 `url:"windgustmph"`
+	Time         time.Time // when the sensors were read
+	PressureHpa  *float64
+	MSLPHpa      *float64
+	TempC        *float64
+	DewPointC    *float64
+	RainMM       float64 // since the last db record
+	RainRate     *float64
+	Humidity     *float64
+	WindDir      *float64
+	WindSpeedMph *float64
+	WindGustMph  *float64
+	WindGustDir  *float64
 }
 
 var wd = weatherData{}
@@ -111,32 +73,36 @@ func loadWeatherData() (*weatherData, error) {
 	return &wd, err
 }
 
-// Reporting called as a go routine:
-// * send data to the wow url every reportFreqMin mins
+// Reporting called as a go routine, it is the one place the sensors are read:
+// * take a snapshot of the sensors, the web server and live stream use the latest
+// * hand the observation to the uploaders (WOW etc), they send it when they're due
 // * update grafana endpoints
 // * update db
-func (w *weatherstation) Reporting() {
+// When ctx is done it saves a last observation and returns.
+func (w *weatherstation) Reporting(ctx context.Context) {
 	/*
 	   Safety net for 'too many open files' issue on legacy code.
 	   Set a sane timeout duration for the http.DefaultClient, to ensure idle connections are terminated.
 	   Reference: https://stackoverflow.com/questions/37454236/net-http-server-too-many-open-files-error
 	*/
 
-	defer func() {
-		w.HeartbeatLed.Off()
-		if *w.args.RainEnabled {
-			w.s.Rain.GetLED().Off()
-		}
-	}()
+	defer w.HeartbeatLed.Off()
 
 	// Set some sensible initial values so we don't get daft prom values
 	Prom_atmPresure.Set(1000.0)
 	Prom_humidity.Set(90)
 
 	duration := time.Minute
-	if *w.args.Test {
+	if w.cfg.Flags.Test {
 		duration = time.Second
 	}
+	// rapid fire uploads need the sensors read more often, those readings only
+	// go to the snapshot and the uploaders, everything else still happens once
+	// every duration
+	period := duration
+	if d := w.uploads.Shortest(); d > 0 && d < period && !w.cfg.Flags.Test {
+		period = d
+	}
 
 	// Load weatherData from file
 	loadedWd, err := loadWeatherData()
@@ -146,13 +112,28 @@ func (w *weatherstation) Reporting() {
 		logger.Errorf("Failed to load weather data: %v", err)
 	}
 
-	// user info
-	wd.SiteId = w.args.WowSiteID
-	wd.AuthKey = w.args.WowPin
-	for t := range time.Tick(duration) {
+	var last time.Time
+	var between float64 // rain read on the rapid fire ticks since the last minute
+	for t := range clock.Tick(ctx, period) {
+		snap := w.sample()
+		w.snapshot.Set(snap)
+		if !w.cfg.Flags.Test {
+			// the uploaders decide for themselves when to send
+			w.uploads.Observe(uploadObservation(snap))
+		}
+		// the rest only on the first reading of each minute
+		if !t.Truncate(duration).After(last) {
+			if snap.RainMM.Usable() {
+				between += snap.RainMM.Value
+			}
+			continue
+		}
+		last = t.Truncate(duration)
+		snap = withRain(snap, between)
+		between = 0
+		w.publish(snap)
+		msg := w.prepData(&wd, snap)
 		func() {
-			msg := w.prepData(&wd)
-			vals, _ := query.Values(wd)
 
 			// send mqtt message with weather data
 			// json format, {"ip_address": "x.x.x.x", "time": "18:46:22 15/08/2025", + rain, temp, wind & humidity
@@ -160,13 +141,21 @@ func (w *weatherstation) Reporting() {
 				dataMap := map[string]interface{}{
 					"name":       "weather_station",
 					"ip_address": GetOutboundIP().String(),
-					"time":       time.Now().Format("15:04:05 02/01/2006"),
+					"time":       wd.Time.Local().Format("15:04:05 02/01/2006"),
 					"rain":       fmt.Sprintf("%.2f", wd.RainMM),
-					"temp":       fmt.Sprintf("%.2f", wd.TempC),
-					"windspeed":  fmt.Sprintf("%.2f", wd.WindSpeedMph),
-					"windgust":   fmt.Sprintf("%.2f", wd.WindGustMph),
-					"winddir":    fmt.Sprintf("%.2f", wd.WindDir),
-					"humidity":   fmt.Sprintf("%.2f", wd.Humidity),
+				}
+				// leave out anything that failed QC
+				for k, v := range map[string]*float64{
+					"temp":        wd.TempC,
+					"windspeed":   wd.WindSpeedMph,
+					"windgust":    wd.WindGustMph,
+					"winddir":     wd.WindDir,
+					"windgustdir": wd.WindGustDir,
+					"humidity":    wd.Humidity,
+				} {
+					if v != nil {
+						dataMap[k] = fmt.Sprintf("%.2f", *v)
+					}
 				}
 				dataBytes, err := json.Marshal(dataMap)
 				if err != nil {
@@ -174,17 +163,17 @@ func (w *weatherstation) Reporting() {
 					return
 				}
 				data := string(dataBytes)
-				token := w.client.Publish(topic, 0, false, data)
+				token := w.client.Publish(w.cfg.MQTT.Topic, 0, false, data)
 				ctx, cnx := context.WithTimeout(context.Background(), time.Second*30)
 				go func(ctx context.Context, cnx context.CancelFunc) {
 					select {
 					case <-ctx.Done():
-						logger.Errorf("Publish to MQTT topic %v timed out after 30s", topic)
+						logger.Errorf("Publish to MQTT topic %v timed out after 30s", w.cfg.MQTT.Topic)
 					case <-token.Done():
 						if token.Error() != nil {
 							logger.Errorf("Failed to publish message: %v", token.Error())
 						} else {
-							logger.Infof("Message published successfully to topic %v", topic)
+							logger.Infof("Message published successfully to topic %v", w.cfg.MQTT.Topic)
 						}
 					}
 					cnx()
@@ -203,175 +192,444 @@ func (w *weatherstation) Reporting() {
 				}()
 			}
 
-			if t.Minute() == 0 && t.Hour() == 9 && *w.args.RainEnabled {
+			if t.Minute() == 0 && t.Hour() == 9 && w.s.Rain != nil {
 				// reset daily rain accumulation
 				logger.Info("Resetting daily rain accumulation")
 				w.s.Rain.ResetDayAccumulation()
-				wd.RainDayIn = 0
 			}
 
-			if *w.args.Verbose {
+			if w.cfg.Flags.Verbose {
 				logger.Infof("Sensor data: %v", msg)
 			}
-			if *w.args.Test {
+			if w.cfg.Flags.Test {
 				// flash LED's only
 				if w.HeartbeatLed.IsOn() {
 					w.HeartbeatLed.Off()
 				} else {
 					w.HeartbeatLed.On()
 				}
-			} else if t.Minute()%env.ReportFreqMin == 0 {
-
-				// write data to db
-				logger.Info("Saving record to db")
-				err := w.Db.WriteRecord(context.Background(), postgres.WriteRecordParams{
-					Temperature:   wd.TempC,
-					Pressure:      wd.PressureHpa,
-					RainMm:        wd.RainMM,
-					WindSpeed:     wd.WindSpeedMph,
-					WindGust:      wd.WindGustMph,
-					WindDirection: wd.WindDir,
-				})
-				if err != nil {
-					logger.Errorf("Failed to write to db [%v]", err)
-				}
+			} else if t.Minute()%w.cfg.Reporting.FreqMin == 0 {
 
-				if !(*w.args.NoWow) {
-					logger.Infof("Sending data to met office [%v]\n[%v]", wd, vals.Encode())
-					logger.Infof("Sensor data: %v", msg)
-					// Metoffice accepts a GET... which is easier so wtf
-					http.DefaultClient.Timeout = time.Minute * 2
-					client := http.Client{Timeout: time.Second * 30}
-					resp, err := client.Get(baseUrl + vals.Encode())
-					if err != nil {
-						logger.Errorf("Failed to POST data [%v] \n [%v]", err, vals.Encode())
-						return
-					}
-					defer resp.Body.Close()
-					if resp.StatusCode != 200 {
-						logger.Errorf("Failed to POST data HTTP [%v] \n Sent[%v]", resp.Status, vals.Encode())
-					} else {
-						// record sent, reset the rain accumulation
-						logger.Info("Resetting rainIn counter")
-						wd.RainIn = 0
-						wd.RainMM = 0
-					}
+				// write data to db, but not a replay of old data
+				if !clock.Replaying() {
+					w.writeRecord(&wd)
 				}
+				wd.RainMM = 0
 
 				// Save weatherData to file
-				err = saveWeatherData(&wd)
+				err := saveWeatherData(&wd)
 				if err != nil {
 					logger.Errorf("Failed to save weather data: %v", err)
 				}
 			}
 		}()
 	}
+	// ctx is done, the last bits get a little longer
+	fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancel()
+	w.finish(fctx, &wd, between)
 }
 
-// build the map with the required data
-func (w *weatherstation) prepData(wd *weatherData) string {
-	msg := ""
-	// Timestamp
-	// go magic date is Mon Jan 2 15:04:05 MST 2006
-	// "The date must be in the following format: YYYY-mm-DD HH:mm:ss"
-	wd.DateString = time.Now().UTC().Format("2006-01-02+15:04:05")
-	// system info
-	wd.SoftwareType = version
+// withRain adds the rain read since the last minute to s
+func withRain(s data.Snapshot, mm float64) data.Snapshot {
+	switch {
+	case mm == 0:
+	case s.RainMM.Usable():
+		s.RainMM.Value += mm
+	default:
+		s.RainMM = data.Value(mm)
+	}
+	return s
+}
 
-	if *w.args.AtmosphericEnabled {
+// finish records a last observation on the way out and saves the state for next
+// time, giving up on the db and uploads when ctx is done
+func (w *weatherstation) finish(ctx context.Context, wd *weatherData, between float64) {
+	logger.Info("Saving the last observation")
+	snap := w.sample()
+	w.snapshot.Set(snap)
+	w.prepData(wd, withRain(snap, between))
+	if w.cfg.Flags.Test {
+		return
+	}
+	w.uploads.Observe(uploadObservation(snap))
+	if !clock.Replaying() {
+		w.writeRecord(wd)
+		// the writer has stopped, have one last go ourselves
+		<-w.dbDone
+		w.flushDb(ctx)
+	}
+	wd.RainMM = 0
+	if err := saveWeatherData(wd); err != nil {
+		logger.Errorf("Failed to save weather data: %v", err)
+	}
+	// any upload in flight has to finish (or be queued) before its rain is saved
+	if err := w.uploads.Wait(ctx); err != nil {
+		logger.Warnf("Uploads still running [%v]", err)
+	}
+	if err := w.uploads.Save(); err != nil {
+		logger.Errorf("Failed to save the upload state [%v]", err)
+	}
+}
 
-		tempC := w.s.Atm.GetTemperature().Float64()
-		wd.TempC = tempC
-		tempf := ctof(tempC)
+// uploadObservation is the snapshot for the uploaders, RainMM is the rain since the last one
+func uploadObservation(s data.Snapshot) upload.Observation {
+	o := upload.Observation{
+		Time:         s.Time,
+		TempC:        usable(s.TemperatureC),
+		Humidity:     usable(s.Humidity),
+		DewPointC:    s.DewPointC,
+		PressureHpa:  usable(s.PressureHpa),
+		MSLPHpa:      s.MSLPHpa,
+		RainDayMM:    s.RainDayMM,
+		RainRate:     usable(s.RainRate),
+		WindSpeedMph: usable(s.WindSpeed),
+		WindDir:      usable(s.WindDir),
+		WindGustMph:  usable(s.WindGust),
+		WindGustDir:  usable(s.WindGustDir),
+	}
+	if s.RainMM.Usable() {
+		o.RainMM = s.RainMM.Value
+	}
+	return o
+}
 
-		Prom_temperature.Set(float64(tempC))
+// usable is the value if it passed QC, nil if not
+func usable(r data.Reading) *float64 {
+	if !r.Usable() {
+		return nil
+	}
+	return value(r.Value)
+}
 
-		pressure, humidity := w.s.Atm.GetHumidityAndPressure()
-		wd.PressureHpa = pressure.Float64()
+// writeRecord saves the observation, anything that failed QC is null. It goes
+// through the queue so nothing is lost if the db is down, dbWriter writes it.
+func (w *weatherstation) writeRecord(wd *weatherData) {
+	rec := postgres.WriteRecordParams{
+		RecordDate:        wd.Time.UTC(),
+		Temperature:       null(wd.TempC),
+		Pressure:          null(wd.PressureHpa),
+		RainMm:            wd.RainMM,
+		WindSpeed:         null(wd.WindSpeedMph),
+		WindGust:          null(wd.WindGustMph),
+		WindDirection:     null(wd.WindDir),
+		Humidity:          null(wd.Humidity),
+		DewPoint:          null(wd.DewPointC),
+		Mslp:              null(wd.MSLPHpa),
+		RainRate:          null(wd.RainRate),
+		WindGustDirection: null(wd.WindGustDir),
+	}
+	if err := w.dbQueue.Push(rec); err != nil {
+		logger.Errorf("Failed to queue db record [%v]", err)
+		// have a go anyway
+		if err := w.Db.WriteRecord(context.Background(), rec); err != nil {
+			logger.Errorf("Failed to write to db [%v]", err)
+		}
+		return
+	}
+	select {
+	case w.dbKick <- struct{}{}:
+	default:
+		// it already knows
+	}
+}
 
-		Prom_humidity.Set(humidity.Float64())
+// dbWriter writes the queued records in the background so a slow or missing db
+// never holds up the sampling. After a failure it waits, longer each time,
+// before trying again. It stops when ctx is done.
+func (w *weatherstation) dbWriter(ctx context.Context) {
+	defer close(w.dbDone)
+	var delay time.Duration // 0 while the db is working
+	for {
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.dbKick:
+			}
+		}
+		if w.flushDb(ctx) {
+			delay = 0
+			continue
+		}
+		delay = min(max(delay*2, dbRetryDelay), dbMaxRetryDelay)
+		logger.Warnf("Trying the db again in %v", delay)
+	}
+}
 
-		pressureInHg := pressure * env.HPaToInHg
+// flushDb writes the queued records, oldest first, until the queue is empty or
+// the db fails, then updates the rollups they are in. It's true if they all went.
+func (w *weatherstation) flushDb(ctx context.Context) bool {
+	var written []time.Time
+	sent, err := w.dbQueue.Drain(func(rec postgres.WriteRecordParams) error {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if err := w.Db.WriteRecord(ctx, rec); err != nil {
+			return err
+		}
+		written = append(written, rec.RecordDate)
+		return nil
+	})
+	if sent > 0 {
+		logger.Infof("Saved [%v] records to db", sent)
+	}
+	if len(written) > 0 && w.rollups != nil {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		if err := w.rollups.Update(ctx, written...); err != nil {
+			// weather rollup will sort them out
+			logger.Errorf("Failed to update the rollups [%v]", err)
+		}
+	}
+	if err != nil {
+		logger.Errorf("Failed to write to db, [%v] records queued [%v]", w.dbQueue.Len(), err)
+	}
+	Prom_dbQueueDepth.Set(float64(w.dbQueue.Len()))
+	return w.dbQueue.Len() == 0
+}
 
-		/*
-			3. Convert the average temperature to Kelvin by adding 273.1 to the Celsius value.
-		*/
+// observe reads all the sensors, anything switched off, not found or that fails to read is Missing
+func (w *weatherstation) observe() data.Observation {
+	missing := func(enabled bool) data.Reading {
+		if enabled {
+			return data.NoValue("no sensor")
+		}
+		return data.NoValue("disabled")
+	}
+	atm, rain, wind := missing(w.cfg.Sensors.Atmosphere.Enabled), missing(w.cfg.Sensors.Rain.Enabled), missing(w.cfg.Sensors.Wind.Enabled)
+	o := data.Observation{
+		Time:         clock.Now().Truncate(time.Second),
+		TemperatureC: atm, Humidity: atm, PressureHpa: atm,
+		RainMM: rain, RainRate: rain,
+		WindSpeed: wind, WindDir: wind, WindGust: wind, WindGustDir: wind,
+	}
 
-		tempK := tempC + kelvin
+	have := w.s.Available()
+	if have.Temperature {
+		tempC, err := w.s.Temp.GetTemperature()
+		if err != nil {
+			logger.Errorf("Temperature read failed [%v]", err)
+			o.TemperatureC = data.NoValue(err.Error())
+		} else {
+			o.TemperatureC = data.Value(tempC.Float64())
+		}
+	}
+	if have.Atmosphere {
+		pressure, humidity, err := w.s.Atm.GetHumidityAndPressure()
+		if err != nil {
+			logger.Errorf("Pressure and humidity read failed [%v]", err)
+			o.PressureHpa = data.NoValue(err.Error())
+			o.Humidity = data.NoValue(err.Error())
+		} else {
+			o.PressureHpa = data.Value(pressure.Float64())
+			o.Humidity = data.Value(humidity.Float64())
+		}
+	}
 
-		/*
-			4. Compute the scale height H = RdT/g, where Rd = 287.1 J/(kg K) and g = 9.807 m/s2.
-			Be sure to record H to at least 4 significant figures.
-		*/
+	if have.Rain {
+		// GetAccumulation reads and resets the counter
+		o.RainMM = data.Value(w.s.Rain.GetAccumulation().Float64())
+		o.RainRate = data.Value(w.s.Rain.GetRate().Float64())
+	}
 
-		H := (Rd * tempK) / g
+	if have.Wind {
+		// reports get the WMO 10 minute mean
+		o.WindSpeed = data.Value(w.s.Wind.GetMeanSpeed())
+		o.WindDir = data.Value(w.s.Wind.GetMeanDirection())
+		o.WindGust = data.Value(w.s.Wind.GetGust())
+		o.WindGustDir = data.Value(w.s.Wind.GetGustDirection())
+	}
+	return o
+}
 
-		/*
-			5. Compute the sea level pressure psl from
-			psl = p0 exp(z0/H)
-			where p0 is the observed pressure and z0 is the altitude above sea level where you
-			made your pressure observation.
-		*/
+// sample reads the sensors and checks the readings, the snapshot is what everything reports
+func (w *weatherstation) sample() data.Snapshot {
+	o := w.observe()
+	w.qc.Check(&o, o.Time)
+
+	have := w.s.Available()
+	s := data.Snapshot{
+		Observation: o,
+		Sensors: map[string]bool{
+			"temperature": have.Temperature,
+			"atmosphere":  have.Atmosphere,
+			"rain":        have.Rain,
+			"wind":        have.Wind,
+		},
+	}
+	if o.TemperatureC.Usable() && o.Humidity.Usable() {
+		//Td = T - ((100 - RH)/5.)
+		s.DewPointC = value(o.TemperatureC.Value - ((100 - o.Humidity.Value) / 5.0))
+	}
+	if o.PressureHpa.Usable() && o.TemperatureC.Usable() {
+		s.MSLPHpa = value(mslp(o.PressureHpa.Value, o.TemperatureC.Value, w.cfg.Station.Altitude))
+	}
+	if have.Rain {
+		s.RainDayMM = value(w.s.Rain.GetDayAccumulation().Float64())
+	}
 
-		mslp := pressureInHg.Float64() * math.Exp(z0/H)
-		Prom_atmPresure.Set(pressure.Float64())
+	off := data.NoValue("disabled")
+	s.WindSpeedNow, s.WindDirNow, s.WindDirSD = off, off, off
+	if have.Wind {
+		s.WindSpeedNow = data.Value(w.s.Wind.GetSpeed())
+		s.WindDirNow = data.Value(w.s.Wind.GetDirection())
+		s.WindDirSD = data.Value(w.s.Wind.GetDirectionStdDev())
+	}
+	return s
+}
 
-		wd.Humidity = humidity.Float64()
-		wd.TempF = tempf
-		//Td = T - ((100 - RH)/5.)
-		dewPoint_f := ((((tempC + 273) - ((100 - (humidity.Float64())) / 5.0)) - 273) * 9 / 5.0) + 32
-		wd.DewPointF = dewPoint_f
+// latest is the latest snapshot for the api, false until the first one
+func (w *weatherstation) latest() (api.Current, bool) {
+	s, ok := w.snapshot.Get()
+	if !ok {
+		return api.Current{}, false
+	}
+	return current(s), true
+}
 
-		wd.PressureIn = mslp
-		msg = fmt.Sprintf("Pressure [%2f], Humidity [%2f], Temperature [%2f]", pressure, humidity, tempC)
-	} else {
-		msg = msg + "Pressure [-], Humidity [-], Temperature [-]"
+func current(s data.Snapshot) api.Current {
+	return api.Current{
+		Observation: s.Observation,
+		DewPointC:   s.DewPointC,
+		MSLPHpa:     s.MSLPHpa,
+		RainDayMM:   s.RainDayMM,
+		Sensors:     s.Sensors,
 	}
+}
 
-	if *w.args.RainEnabled {
-		// we have to work out the values we send to the met office when we send it as they
-		// what amount since last sent
-		acc := w.s.Rain.GetAccumulation().Float64() // GetAccumulation reads and resets the counter
-		wd.RainMM += acc
-		rainInch := mmToIn(acc)
-		wd.RainIn += rainInch
-		wd.RainDayIn += rainInch
-		Prom_rainDayTotal.Add(acc)
-		Prom_rainRatePerMin.Set(w.s.Rain.GetRate().Float64())
-		// if *w.args.Verbose {
-		logger.Infof("Rain rate per hour [%v] acc [%v] wd.rainIn [%v]", w.s.Rain.GetRate().Float64(), acc, wd.RainIn)
-		// }
-		msg = msg + fmt.Sprintf(", Rain accumulation [%v] (RainIn  [%v]) (DayIn [%v])", acc, wd.RainIn, wd.RainDayIn)
-	} else {
-		msg = msg + ", Rain accumulation [-]"
+// mslp is the pressure at sea level
+func mslp(pressureHpa, tempC, altitude float64) float64 {
+	/*
+		3. Convert the average temperature to Kelvin by adding 273.1 to the Celsius value.
+	*/
+
+	tempK := tempC + kelvin
+
+	/*
+		4. Compute the scale height H = RdT/g, where Rd = 287.1 J/(kg K) and g = 9.807 m/s2.
+		Be sure to record H to at least 4 significant figures.
+	*/
+
+	H := (Rd * tempK) / g
+
+	/*
+		5. Compute the sea level pressure psl from
+		psl = p0 exp(z0/H)
+		where p0 is the observed pressure and z0 is the altitude above sea level where you
+		made your pressure observation.
+	*/
+
+	return pressureHpa * math.Exp(altitude/H)
+}
+
+// build the map with the required data from the snapshot, anything that fails QC is left out
+func (w *weatherstation) prepData(wd *weatherData, s data.Snapshot) string {
+	o := s.Observation
+
+	// Timestamp, everything uses the time the sensors were read
+	wd.Time = o.Time
+
+	for name, r := range o.Readings() {
+		Prom_quality.WithLabelValues(name).Set(float64(r.Quality))
+		if r.Quality == data.Suspect || r.Quality == data.Bad {
+			logger.Warnf("QC %v [%v] is %v [%v]", name, r.Value, r.Quality, r.Reason)
+		}
 	}
 
-	if *w.args.WindEnabled {
-		windDirection := w.s.Wind.GetDirection()
-		Prom_windDirection.Set(windDirection)
+	wd.TempC = nil
+	if o.TemperatureC.Usable() {
+		wd.TempC = value(o.TemperatureC.Value)
+		Prom_temperature.Set(o.TemperatureC.Value)
+	}
 
-		windSpeed := w.s.Wind.GetSpeed()
-		windGust := w.s.Wind.GetGust()
+	wd.Humidity = nil
+	if o.Humidity.Usable() {
+		wd.Humidity = value(o.Humidity.Value)
+		Prom_humidity.Set(o.Humidity.Value)
+	}
 
-		Prom_windspeed.Set(windSpeed)
-		Prom_windgust.Set(windGust)
+	wd.DewPointC = s.DewPointC
 
-		wd.WindDir = windDirection
-		wd.WindSpeedMph = windSpeed
-		wd.WindGustMph = windGust
-		msg = msg + fmt.Sprintf(", Dir [%2f] (%v), Speed [%2f] Gust [%2f]", windDirection, w.s.Wind.DirStr, windSpeed, windGust)
-	} else {
-		msg = msg + ", Dir [-], Speed [-], Gust [-]"
+	wd.PressureHpa, wd.MSLPHpa = nil, nil
+	if o.PressureHpa.Usable() {
+		wd.PressureHpa = value(o.PressureHpa.Value)
+		Prom_atmPresure.Set(o.PressureHpa.Value)
 	}
+	wd.MSLPHpa = s.MSLPHpa
+	msg := fmt.Sprintf("Pressure [%v], Humidity [%v], Temperature [%v]", show(o.PressureHpa), show(o.Humidity), show(o.TemperatureC))
+
+	if o.RainMM.Usable() {
+		// the db record has the rain since the last one
+		acc := o.RainMM.Value
+		wd.RainMM += acc
+		Prom_rainDayTotal.Add(acc)
+	}
+	wd.RainRate = nil
+	if o.RainRate.Usable() {
+		wd.RainRate = value(o.RainRate.Value)
+		Prom_rainRatePerMin.Set(o.RainRate.Value)
+	}
+	if w.s.Rain != nil {
+		logger.Infof("Rain rate per hour [%v] acc [%v] wd.rainMM [%v]", show(o.RainRate), show(o.RainMM), wd.RainMM)
+	}
+	msg = msg + fmt.Sprintf(", Rain accumulation [%v] (RainMM [%v]) (Day [%v])", show(o.RainMM), wd.RainMM, showPtr(s.RainDayMM))
+
+	wd.WindDir, wd.WindSpeedMph, wd.WindGustMph, wd.WindGustDir = nil, nil, nil, nil
+	if o.WindSpeed.Usable() {
+		wd.WindSpeedMph = value(o.WindSpeed.Value)
+		Prom_windspeed.Set(s.WindSpeedNow.Value)
+		Prom_windspeed10m.Set(o.WindSpeed.Value)
+	}
+	if o.WindDir.Usable() {
+		wd.WindDir = value(o.WindDir.Value)
+		Prom_windDirection.Set(s.WindDirNow.Value)
+		Prom_windDirectionSD.Set(s.WindDirSD.Value)
+	}
+	if o.WindGust.Usable() {
+		wd.WindGustMph = value(o.WindGust.Value)
+		Prom_windgust.Set(o.WindGust.Value)
+	}
+	if o.WindGustDir.Usable() {
+		wd.WindGustDir = value(o.WindGustDir.Value)
+		Prom_windgustDirection.Set(o.WindGustDir.Value)
+	}
+	msg = msg + fmt.Sprintf(", Dir [%v], Speed [%v] Gust [%v] from [%v]", show(o.WindDir), show(o.WindSpeed), show(o.WindGust), show(o.WindGustDir))
 
 	return msg
 }
 
-func ctof(c float64) float64 {
-	//(0°C × 9/5) + 32 = 32°F
-	return ((c * 9 / 5) + 32)
+func value(v float64) *float64 {
+	return &v
 }
 
-func mmToIn(mm float64) float64 {
-	return mm / env.MmToInch
+func null(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
+
+// show a reading for the logs
+func show(r data.Reading) string {
+	switch r.Quality {
+	case data.Good:
+		return fmt.Sprintf("%.2f", r.Value)
+	case data.Missing:
+		return "-"
+	default:
+		return fmt.Sprintf("%.2f %v: %v", r.Value, r.Quality, r.Reason)
+	}
+}
+
+func showPtr(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *v)
 }
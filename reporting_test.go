@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/data"
+	"github.com/gr-butler/weather/db/postgres"
+	"github.com/gr-butler/weather/qc"
+	"github.com/gr-butler/weather/queue"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/sensors"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAtmosphere struct {
+	temp     sensors.TemperatureC
+	pressure sensors.PressurehPa
+	humidity sensors.RelHumidity
+	err      error
+	reads    int
+}
+
+func (f *fakeAtmosphere) GetTemperature() (sensors.TemperatureC, error) {
+	f.reads++
+	return f.temp, f.err
+}
+
+func (f *fakeAtmosphere) GetHumidityAndPressure() (sensors.PressurehPa, sensors.RelHumidity, error) {
+	f.reads++
+	return f.pressure, f.humidity, f.err
+}
+
+type fakeRain struct {
+	acc sensors.Mm
+	day sensors.Mm
+}
+
+func (f *fakeRain) GetRate() sensors.MmHr          { return 0 }
+func (f *fakeRain) GetDayAccumulation() sensors.Mm { return f.day }
+func (f *fakeRain) ResetDayAccumulation()          { f.day = 0 }
+func (f *fakeRain) GetAccumulation() sensors.Mm    { a := f.acc; f.acc = 0; return a }
+
+type fakeWind struct{}
+
+func (f *fakeWind) GetSpeed() float64           { return 12 }
+func (f *fakeWind) GetMeanSpeed() float64       { return 10 }
+func (f *fakeWind) GetGust() float64            { return 20 }
+func (f *fakeWind) GetGustDirection() float64   { return 100 }
+func (f *fakeWind) GetDirection() float64       { return 80 }
+func (f *fakeWind) GetMeanDirection() float64   { return 90 }
+func (f *fakeWind) GetDirectionStdDev() float64 { return 5 }
+func (f *fakeWind) GetDirStr() string           { return "E" }
+
+func Test_prepData(t *testing.T) {
+	atm := &fakeAtmosphere{temp: 20, pressure: 1000, humidity: 50}
+	w := weatherstation{
+		s: &sensors.Sensors{
+			Temp: atm,
+			Atm:  atm,
+			Rain: &fakeRain{acc: 2.54},
+			Wind: &fakeWind{},
+		},
+		cfg: env.Default(),
+		qc:  qc.NewChecker(),
+	}
+
+	d := weatherData{}
+	snap := w.sample()
+	w.prepData(&d, snap)
+
+	require.False(t, d.Time.IsZero())
+	require.Equal(t, snap.Time, d.Time)
+	require.Equal(t, float64(20), *d.TempC)
+	require.Equal(t, float64(1000), *d.PressureHpa)
+	require.Equal(t, float64(50), *d.Humidity)
+	require.Equal(t, float64(10), *d.DewPointC)
+	require.InDelta(t, 1002.88, *d.MSLPHpa, 0.01)
+	require.InDelta(t, 2.54, d.RainMM, 0.0001)
+	require.Equal(t, float64(10), *d.WindSpeedMph)
+	require.Equal(t, float64(20), *d.WindGustMph)
+	require.Equal(t, float64(90), *d.WindDir)
+	require.Equal(t, float64(100), *d.WindGustDir)
+
+	// rain is accumulated until the db record is written
+	w.prepData(&d, w.sample())
+	require.InDelta(t, 2.54, d.RainMM, 0.0001)
+
+	// the uploaders get what passed QC, with the rain since the last observation
+	o := uploadObservation(snap)
+	require.Equal(t, 2.54, o.RainMM)
+	require.Equal(t, float64(20), *o.TempC)
+	require.Equal(t, float64(90), *o.WindDir)
+
+	// a failed read is left out, not sent as 0
+	atm.err = errors.New("BME280 read failed")
+	snap = w.sample()
+	w.prepData(&d, snap)
+	require.Nil(t, d.TempC)
+	require.Nil(t, d.PressureHpa)
+	require.Nil(t, d.MSLPHpa)
+	require.Nil(t, d.DewPointC)
+	require.NotNil(t, d.WindDir)
+	o = uploadObservation(snap)
+	require.Nil(t, o.TempC)
+	require.Nil(t, o.MSLPHpa)
+	require.NotNil(t, o.WindDir)
+}
+
+func Test_handler(t *testing.T) {
+	atm := &fakeAtmosphere{temp: 20, pressure: 1000, humidity: 50}
+	w := weatherstation{
+		s:   &sensors.Sensors{Temp: atm, Atm: atm, Rain: &fakeRain{day: 3}, Wind: &fakeWind{}},
+		cfg: env.Default(),
+		qc:  qc.NewChecker(),
+	}
+	get := func() *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		w.handler(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rw
+	}
+	require.Equal(t, http.StatusServiceUnavailable, get().Code)
+
+	snap := w.sample()
+	// an older observation, so the time can't be mistaken for the request time
+	snap.Time = snap.Time.Add(-time.Hour)
+	w.snapshot.Set(snap)
+	reads := atm.reads
+
+	// web requests only read the snapshot, never the sensors
+	for range 3 {
+		rw := get()
+		require.Equal(t, http.StatusOK, rw.Code)
+		var wd webdata
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &wd))
+		require.Equal(t, snap.Time.UTC().Format(time.RFC822), wd.TimeNow)
+		require.Equal(t, float64(20), *wd.TempHiRes)
+		require.Equal(t, float64(3), wd.RainDay)
+		require.Equal(t, float64(12), wd.WindSpeed)
+		require.Equal(t, float64(10), wd.WindMean)
+	}
+	require.Equal(t, reads, atm.reads)
+
+	// and the api gets the same one
+	c, ok := w.latest()
+	require.True(t, ok)
+	require.Equal(t, snap.Time, c.Observation.Time)
+	require.Equal(t, *snap.DewPointC, *c.DewPointC)
+}
+
+type fakeDb struct {
+	postgres.Querier
+	down    bool
+	records []postgres.WriteRecordParams
+}
+
+func (f *fakeDb) GetAllRecords(ctx context.Context) ([]postgres.Weather, error) {
+	return nil, nil
+}
+
+func (f *fakeDb) WriteRecord(ctx context.Context, arg postgres.WriteRecordParams) error {
+	if f.down {
+		return errors.New("connection refused")
+	}
+	f.records = append(f.records, arg)
+	return nil
+}
+
+func Test_writeRecord(t *testing.T) {
+	q, err := queue.Open[postgres.WriteRecordParams](filepath.Join(t.TempDir(), "q.jsonl"))
+	require.NoError(t, err)
+	db := &fakeDb{down: true}
+	w := weatherstation{Db: db, dbQueue: q, dbKick: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	temp := 10.0
+	w.writeRecord(&weatherData{Time: start, TempC: &temp})
+	require.False(t, w.flushDb(ctx))
+	temp = 11
+	w.writeRecord(&weatherData{Time: start.Add(15 * time.Minute), TempC: &temp})
+	require.False(t, w.flushDb(ctx))
+	require.Equal(t, 2, q.Len())
+	require.Empty(t, db.records)
+	// dbWriter is told there's something to write
+	require.Len(t, w.dbKick, 1)
+
+	db.down = false
+	temp = 12
+	w.writeRecord(&weatherData{Time: start.Add(30 * time.Minute), TempC: &temp})
+	require.True(t, w.flushDb(ctx))
+	require.Equal(t, 0, q.Len())
+	require.Len(t, db.records, 3)
+	for i, r := range db.records {
+		require.Equal(t, 10.0+float64(i), r.Temperature.Float64)
+		// the time it was read, not when the db got it
+		require.True(t, start.Add(time.Duration(i)*15*time.Minute).Equal(r.RecordDate))
+	}
+	require.False(t, db.records[0].Humidity.Valid)
+}
+
+func Test_withRain(t *testing.T) {
+	s := data.Snapshot{Observation: data.Observation{RainMM: data.Value(0.3)}}
+	require.InDelta(t, 0.8, withRain(s, 0.5).RainMM.Value, 0.0001)
+	require.Equal(t, s, withRain(s, 0))
+	// the rapid fire ticks' rain isn't lost if the minute's reading failed
+	s.RainMM = data.NoValue("read failed")
+	require.InDelta(t, 0.5, withRain(s, 0.5).RainMM.Value, 0.0001)
+	require.True(t, withRain(s, 0.5).RainMM.Usable())
+}
+
+func Test_observeMissingSensor(t *testing.T) {
+	// the BME280 didn't come up but the MCP9808 did
+	atm := &fakeAtmosphere{temp: 20}
+	w := weatherstation{
+		s:   &sensors.Sensors{Temp: atm, Rain: &fakeRain{}},
+		cfg: env.Default(),
+		qc:  qc.NewChecker(),
+	}
+	snap := w.sample()
+	require.Equal(t, data.Good, snap.TemperatureC.Quality)
+	require.Equal(t, float64(20), snap.TemperatureC.Value)
+	require.Equal(t, data.Missing, snap.PressureHpa.Quality)
+	require.Equal(t, "no sensor", snap.Humidity.Reason)
+	require.Equal(t, data.Missing, snap.WindSpeed.Quality)
+	require.True(t, snap.Sensors["temperature"])
+	require.False(t, snap.Sensors["atmosphere"])
+	// and the config still says what was asked for
+	require.True(t, w.cfg.Sensors.Atmosphere.Enabled)
+}
@@ -0,0 +1,261 @@
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gr-butler/weather/db/postgres"
+)
+
+/*
+Summaries of the weather table for each hour, day and month, kept in the
+weather_hourly, weather_daily and weather_monthly tables so nothing has to read
+years of records.
+
+A record covers the time since the one before it, so a period has the records
+after its start up to and including its end. The day is 09:00 to 09:00 local
+time like the rain total, and a month is the days that start in it.
+
+Every rollup is worked out again from the records in its period rather than
+added to, so replaying the db queue or a backfill can't count a record twice.
+*/
+
+type Period int
+
+const (
+	Hour Period = iota
+	Day
+	Month
+)
+
+var Periods = []Period{Hour, Day, Month}
+
+func (p Period) String() string {
+	switch p {
+	case Hour:
+		return "hour"
+	case Day:
+		return "day"
+	default:
+		return "month"
+	}
+}
+
+// DayStartHour is when the climatological day starts, 09:00
+const DayStartHour = 9
+
+// Start is the start of the period a record at t is in, in t's time zone.
+func (p Period) Start(t time.Time) time.Time {
+	switch p {
+	case Hour:
+		s := t.Truncate(time.Hour)
+		if s.Equal(t) {
+			s = s.Add(-time.Hour)
+		}
+		return s
+	case Day:
+		s := time.Date(t.Year(), t.Month(), t.Day(), DayStartHour, 0, 0, 0, t.Location())
+		if !s.Before(t) {
+			s = s.AddDate(0, 0, -1)
+		}
+		return s
+	default:
+		s := time.Date(t.Year(), t.Month(), 1, DayStartHour, 0, 0, 0, t.Location())
+		if !s.Before(t) {
+			s = s.AddDate(0, -1, 0)
+		}
+		return s
+	}
+}
+
+// End is the end of the period starting at start, days aren't always 24 hours
+func (p Period) End(start time.Time) time.Time {
+	switch p {
+	case Hour:
+		return start.Add(time.Hour)
+	case Day:
+		return start.AddDate(0, 0, 1)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// Roller keeps the rollup tables up to date
+type Roller struct {
+	db  postgres.Querier
+	loc *time.Location
+}
+
+// New makes a Roller with the day starting at 09:00 in loc, the station's time zone.
+func New(db postgres.Querier, loc *time.Location) *Roller {
+	return &Roller{db: db, loc: loc}
+}
+
+// Update works out each hour, day and month with a record at one of times in it again.
+func (r *Roller) Update(ctx context.Context, times ...time.Time) error {
+	for _, p := range Periods {
+		done := map[int64]bool{}
+		for _, t := range times {
+			start := p.Start(t.In(r.loc))
+			if done[start.Unix()] {
+				continue
+			}
+			done[start.Unix()] = true
+			recs, err := r.records(ctx, start, p.End(start))
+			if err != nil {
+				return err
+			}
+			if err := r.save(ctx, p, start, recs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Backfill works out every rollup from the month with from in it up to until,
+// reading a month of records at a time. A zero from starts at the first record.
+// It returns the number of months done.
+func (r *Roller) Backfill(ctx context.Context, from, until time.Time) (int, error) {
+	if from.IsZero() {
+		first, err := r.db.GetFirstRecordDate(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		from = first
+	}
+	months := 0
+	for m := Month.Start(from.In(r.loc)); m.Before(until); m = Month.End(m) {
+		end := Month.End(m)
+		recs, err := r.records(ctx, m, end)
+		if err != nil {
+			return months, err
+		}
+		if err := r.save(ctx, Month, m, recs); err != nil {
+			return months, err
+		}
+		for _, p := range []Period{Day, Hour} {
+			for s := m; s.Before(end); s = p.End(s) {
+				if err := r.save(ctx, p, s, between(recs, s, p.End(s))); err != nil {
+					return months, err
+				}
+			}
+		}
+		months++
+	}
+	return months, nil
+}
+
+func (r *Roller) records(ctx context.Context, after, until time.Time) ([]postgres.Weather, error) {
+	// UTC, SQLite compares them as text
+	return r.db.GetRecordsBetween(ctx, postgres.GetRecordsBetweenParams{After: after.UTC(), Until: until.UTC()})
+}
+
+// save writes the rollup for a period, a period with no records is left out
+func (r *Roller) save(ctx context.Context, p Period, start time.Time, recs []postgres.Weather) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	s := summarise(start, recs)
+	switch p {
+	case Hour:
+		return r.db.UpsertHourly(ctx, s)
+	case Day:
+		return r.db.UpsertDaily(ctx, postgres.UpsertDailyParams(s))
+	default:
+		return r.db.UpsertMonthly(ctx, postgres.UpsertMonthlyParams(s))
+	}
+}
+
+// between is the records in (after, until], recs is in time order
+func between(recs []postgres.Weather, after, until time.Time) []postgres.Weather {
+	var in []postgres.Weather
+	for _, r := range recs {
+		if r.RecordDate.After(after) && !r.RecordDate.After(until) {
+			in = append(in, r)
+		}
+	}
+	return in
+}
+
+// wind slower than this (mph) is calm and doesn't count towards the prevailing direction
+const calm = 1.0
+
+// summarise works out the rollup for the records in a period, the tables all
+// have the same columns so it's used for all three
+func summarise(start time.Time, recs []postgres.Weather) postgres.UpsertHourlyParams {
+	s := postgres.UpsertHourlyParams{PeriodStart: start.UTC(), Samples: int32(len(recs))}
+	var temp, pressure, mslp, wind stats
+	sectors := make([]int, 16)
+	for _, r := range recs {
+		temp.add(r.Temperature)
+		pressure.add(r.Pressure)
+		mslp.add(r.Mslp)
+		wind.add(r.WindSpeed)
+		s.RainMm += r.RainMm
+		if r.WindGust.Valid && (!s.GustMax.Valid || r.WindGust.Float64 > s.GustMax.Float64) {
+			s.GustMax = r.WindGust
+			s.GustTime = sql.NullTime{Time: r.RecordDate.UTC(), Valid: true}
+			s.GustDirection = r.WindGustDirection
+		}
+		if r.WindSpeed.Valid && r.WindSpeed.Float64 >= calm && r.WindDirection.Valid {
+			sectors[int(math.Round(r.WindDirection.Float64/22.5))%16]++
+		}
+	}
+	s.TempMin, s.TempMax, s.TempMean = temp.min(), temp.max(), temp.mean()
+	s.PressureMin, s.PressureMax = pressure.min(), pressure.max()
+	s.MslpMin, s.MslpMax = mslp.min(), mslp.max()
+	s.WindMean = wind.mean()
+
+	// prevailing is the compass point the wind was from most often
+	most := 0
+	for i, n := range sectors {
+		if n > most {
+			most = n
+			s.WindPrevailing = sql.NullFloat64{Float64: float64(i) * 22.5, Valid: true}
+		}
+	}
+	return s
+}
+
+// stats of a column, ignoring nulls
+type stats struct {
+	n        int
+	sum      float64
+	low, top float64
+}
+
+func (s *stats) add(v sql.NullFloat64) {
+	if !v.Valid {
+		return
+	}
+	if s.n == 0 || v.Float64 < s.low {
+		s.low = v.Float64
+	}
+	if s.n == 0 || v.Float64 > s.top {
+		s.top = v.Float64
+	}
+	s.n++
+	s.sum += v.Float64
+}
+
+func (s stats) min() sql.NullFloat64 {
+	return sql.NullFloat64{Float64: s.low, Valid: s.n > 0}
+}
+
+func (s stats) max() sql.NullFloat64 {
+	return sql.NullFloat64{Float64: s.top, Valid: s.n > 0}
+}
+
+func (s stats) mean() sql.NullFloat64 {
+	if s.n == 0 {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: s.sum / float64(s.n), Valid: true}
+}
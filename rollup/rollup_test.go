@@ -0,0 +1,136 @@
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/db/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriod(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, london)
+		require.NoError(t, err)
+		return tm
+	}
+
+	// 09:00 is the last record of the day before
+	require.Equal(t, at("2025-03-14 09:00"), Day.Start(at("2025-03-15 09:00")))
+	require.Equal(t, at("2025-03-15 09:00"), Day.Start(at("2025-03-15 09:15")))
+	require.Equal(t, at("2025-03-15 12:00"), Hour.Start(at("2025-03-15 12:45")))
+	require.Equal(t, at("2025-03-15 11:00"), Hour.Start(at("2025-03-15 12:00")))
+	require.Equal(t, at("2025-02-01 09:00"), Month.Start(at("2025-03-01 08:45")))
+	require.Equal(t, at("2025-03-01 09:00"), Month.Start(at("2025-03-01 09:15")))
+
+	// the clocks go forward
+	start := Day.Start(at("2025-03-30 08:00"))
+	require.Equal(t, 23*time.Hour, Day.End(start).Sub(start))
+}
+
+type fakeDb struct {
+	postgres.Querier
+	records []postgres.Weather
+	hourly  map[time.Time]postgres.UpsertHourlyParams
+	daily   map[time.Time]postgres.UpsertDailyParams
+	monthly map[time.Time]postgres.UpsertMonthlyParams
+}
+
+func newFakeDb() *fakeDb {
+	return &fakeDb{
+		hourly:  map[time.Time]postgres.UpsertHourlyParams{},
+		daily:   map[time.Time]postgres.UpsertDailyParams{},
+		monthly: map[time.Time]postgres.UpsertMonthlyParams{},
+	}
+}
+
+func (f *fakeDb) GetFirstRecordDate(ctx context.Context) (time.Time, error) {
+	if len(f.records) == 0 {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return f.records[0].RecordDate, nil
+}
+
+func (f *fakeDb) GetRecordsBetween(ctx context.Context, arg postgres.GetRecordsBetweenParams) ([]postgres.Weather, error) {
+	return between(f.records, arg.After, arg.Until), nil
+}
+
+func (f *fakeDb) UpsertHourly(ctx context.Context, arg postgres.UpsertHourlyParams) error {
+	f.hourly[arg.PeriodStart] = arg
+	return nil
+}
+
+func (f *fakeDb) UpsertDaily(ctx context.Context, arg postgres.UpsertDailyParams) error {
+	f.daily[arg.PeriodStart] = arg
+	return nil
+}
+
+func (f *fakeDb) UpsertMonthly(ctx context.Context, arg postgres.UpsertMonthlyParams) error {
+	f.monthly[arg.PeriodStart] = arg
+	return nil
+}
+
+func value(v float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: v, Valid: true}
+}
+
+func TestRoller(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeDb()
+	r := New(db, time.UTC)
+
+	// a record every 15 minutes from 08:15 on the 1st to 09:00 on the 2nd
+	start := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	for i := 1; i <= 100; i++ {
+		at := start.Add(time.Duration(i) * 15 * time.Minute)
+		rec := postgres.Weather{
+			RecordDate:    at,
+			Temperature:   value(5 + float64(i%10)),
+			Pressure:      value(1000),
+			RainMm:        0.2,
+			WindSpeed:     value(10),
+			WindDirection: value(270),
+			WindGust:      value(15),
+		}
+		if i == 50 {
+			rec.WindGust = value(40)
+			rec.WindGustDirection = value(250)
+		}
+		if i == 60 {
+			rec.Temperature = sql.NullFloat64{}
+			rec.WindDirection = value(90)
+		}
+		db.records = append(db.records, rec)
+		require.NoError(t, r.Update(ctx, at))
+	}
+	// 08:15 to 09:00 on the 1st, then a whole day
+	require.Len(t, db.daily, 2)
+	day := db.daily[time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)]
+	require.Equal(t, int32(96), day.Samples)
+	require.InDelta(t, 96*0.2, day.RainMm, 0.0001)
+	require.Equal(t, 5.0, day.TempMin.Float64)
+	require.Equal(t, 14.0, day.TempMax.Float64)
+	require.Equal(t, 40.0, day.GustMax.Float64)
+	require.Equal(t, 250.0, day.GustDirection.Float64)
+	require.True(t, start.Add(50*15*time.Minute).Equal(day.GustTime.Time))
+	require.Equal(t, 270.0, day.WindPrevailing.Float64)
+	require.Equal(t, 10.0, day.WindMean.Float64)
+
+	hour := db.hourly[time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)]
+	require.Equal(t, int32(4), hour.Samples)
+	require.Len(t, db.monthly, 2)
+
+	// a backfill gives the same answer
+	filled := newFakeDb()
+	filled.records = db.records
+	months, err := New(filled, time.UTC).Backfill(ctx, time.Time{}, start.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Equal(t, 2, months)
+	require.Equal(t, db.hourly, filled.hourly)
+	require.Equal(t, db.daily, filled.daily)
+	require.Equal(t, db.monthly, filled.monthly)
+}
@@ -0,0 +1,223 @@
+package samplelog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+A compact log of the raw samples read from the sensors.
+
+The file starts with a magic string and the start time (unix micro seconds as a
+varint). Each record is then
+
+	kind     1 byte
+	delta    uvarint, micro seconds since the previous record
+	payload  depends on kind
+
+	Pulses   uvarint pulse count
+	Volts    float32 vane volts
+	Tip      nothing
+	Temp     float32 degrees C
+	Atmos    float32 hPa, float32 %RH
+
+A read that failed has the top bit of the kind set and no payload, so a replay
+of the masthead gets its errors in the same place.
+
+At 4 masthead reads a second most records are 3 to 7 bytes, a day is only a few MB.
+*/
+
+const magic = "WXLOG1\n"
+
+// set in the kind byte for a failed read
+const failedBit = 0x80
+
+type Kind byte
+
+const (
+	Pulses Kind = iota + 1
+	Volts
+	Tip
+	Temp
+	Atmos
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Pulses:
+		return "pulses"
+	case Volts:
+		return "volts"
+	case Tip:
+		return "tip"
+	case Temp:
+		return "temp"
+	case Atmos:
+		return "atmos"
+	}
+	return fmt.Sprintf("kind(%d)", byte(k))
+}
+
+type Record struct {
+	Kind   Kind
+	Time   time.Time
+	Value  float64 // pulse count, volts, degrees C or hPa
+	Value2 float64 // %RH for Atmos
+	Failed bool    // the read failed, there are no values
+}
+
+type Writer struct {
+	lock sync.Mutex
+	w    *bufio.Writer
+	last time.Time
+	buf  []byte
+}
+
+// NewWriter writes the file header and returns a Writer starting at start.
+func NewWriter(w io.Writer, start time.Time) (*Writer, error) {
+	lw := &Writer{w: bufio.NewWriter(w), last: start, buf: make([]byte, 0, 32)}
+	hdr := append([]byte(magic), binary.AppendVarint(nil, start.UnixMicro())...)
+	if _, err := lw.w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return lw, nil
+}
+
+// Write appends a record, records are expected in time order.
+func (lw *Writer) Write(r Record) error {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	delta := r.Time.Sub(lw.last).Microseconds()
+	if delta < 0 {
+		// clock went backwards, keep the log in order
+		delta = 0
+	} else {
+		lw.last = r.Time
+	}
+
+	k := byte(r.Kind)
+	if r.Failed {
+		k |= failedBit
+	}
+	b := append(lw.buf[:0], k)
+	b = binary.AppendUvarint(b, uint64(delta))
+	switch {
+	case r.Kind < Pulses || r.Kind > Atmos:
+		return fmt.Errorf("unknown record kind [%v]", r.Kind)
+	case r.Failed:
+		// no values
+	case r.Kind == Pulses:
+		b = binary.AppendUvarint(b, uint64(r.Value))
+	case r.Kind == Volts, r.Kind == Temp:
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(r.Value)))
+	case r.Kind == Atmos:
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(r.Value)))
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(r.Value2)))
+	}
+	_, err := lw.w.Write(b)
+	return err
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (lw *Writer) Flush() error {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	return lw.w.Flush()
+}
+
+type Reader struct {
+	r     *bufio.Reader
+	start time.Time
+	last  time.Time
+}
+
+// NewReader checks the header and returns a Reader positioned at the first record.
+func NewReader(r io.Reader) (*Reader, error) {
+	lr := &Reader{r: bufio.NewReader(r)}
+	hdr := make([]byte, len(magic))
+	if _, err := io.ReadFull(lr.r, hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr) != magic {
+		return nil, errors.New("not a sample log")
+	}
+	start, err := binary.ReadVarint(lr.r)
+	if err != nil {
+		return nil, err
+	}
+	lr.start = time.UnixMicro(start)
+	lr.last = lr.start
+	return lr, nil
+}
+
+// Start is the time the log was started.
+func (lr *Reader) Start() time.Time {
+	return lr.start
+}
+
+// Read returns the next record, or io.EOF at the end of the log.
+func (lr *Reader) Read() (Record, error) {
+	k, err := lr.r.ReadByte()
+	if err != nil {
+		return Record{}, err
+	}
+	delta, err := binary.ReadUvarint(lr.r)
+	if err != nil {
+		return Record{}, truncated(err)
+	}
+	lr.last = lr.last.Add(time.Duration(delta) * time.Microsecond)
+	r := Record{Kind: Kind(k &^ failedBit), Time: lr.last, Failed: k&failedBit != 0}
+	if r.Failed {
+		if r.Kind < Pulses || r.Kind > Atmos {
+			return Record{}, fmt.Errorf("unknown record kind [%v]", k)
+		}
+		return r, nil
+	}
+
+	switch r.Kind {
+	case Pulses:
+		v, err := binary.ReadUvarint(lr.r)
+		if err != nil {
+			return Record{}, truncated(err)
+		}
+		r.Value = float64(v)
+	case Volts, Temp:
+		if r.Value, err = lr.readFloat(); err != nil {
+			return Record{}, err
+		}
+	case Atmos:
+		if r.Value, err = lr.readFloat(); err != nil {
+			return Record{}, err
+		}
+		if r.Value2, err = lr.readFloat(); err != nil {
+			return Record{}, err
+		}
+	case Tip:
+	default:
+		return Record{}, fmt.Errorf("unknown record kind [%v]", k)
+	}
+	return r, nil
+}
+
+func (lr *Reader) readFloat() (float64, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(lr.r, b); err != nil {
+		return 0, truncated(err)
+	}
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+}
+
+// a record cut short is most likely the station being killed mid write
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
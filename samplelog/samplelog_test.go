@@ -0,0 +1,52 @@
+package samplelog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	start := time.UnixMicro(1700000000000000)
+	records := []Record{
+		{Kind: Pulses, Time: start.Add(250 * time.Millisecond), Value: 3},
+		{Kind: Volts, Time: start.Add(251 * time.Millisecond), Value: 3.5},
+		{Kind: Pulses, Time: start.Add(500 * time.Millisecond), Value: 0},
+		{Kind: Tip, Time: start.Add(2 * time.Second)},
+		{Kind: Temp, Time: start.Add(time.Minute), Value: 12.5},
+		{Kind: Atmos, Time: start.Add(time.Minute), Value: 1013.25, Value2: 87},
+		{Kind: Pulses, Time: start.Add(time.Minute + 250*time.Millisecond), Failed: true},
+		{Kind: Pulses, Time: start.Add(time.Minute + 500*time.Millisecond), Value: 2},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, start)
+	require.NoError(t, err)
+	for _, r := range records {
+		require.NoError(t, w.Write(r))
+	}
+	require.NoError(t, w.Flush())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, start, r.Start())
+	for _, want := range records {
+		got, err := r.Read()
+		require.NoError(t, err)
+		require.Equal(t, want.Kind, got.Kind)
+		require.True(t, want.Time.Equal(got.Time))
+		require.InDelta(t, want.Value, got.Value, 0.001)
+		require.InDelta(t, want.Value2, got.Value2, 0.001)
+		require.Equal(t, want.Failed, got.Failed)
+	}
+	_, err = r.Read()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestBadHeader(t *testing.T) {
+	_, err := NewReader(bytes.NewBufferString("not a log at all"))
+	require.Error(t, err)
+}
@@ -1,10 +1,15 @@
 package sensors
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gr-butler/weather/buffer"
+	"github.com/gr-butler/weather/clock"
 	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/qc"
 	logger "github.com/sirupsen/logrus"
 	"periph.io/x/conn/v3/i2c"
 	"periph.io/x/conn/v3/physic"
@@ -12,217 +17,295 @@ import (
 )
 
 type Anemometer struct {
-	dirADC   *ads1x15.PinADC
-	Bus      *i2c.Bus
+	pulses PulseCounter
+	vane   VaneReader
+	cal    *vaneTable
+	// held while adding to or reading both buffers, so the samples line up
+	lock     sync.Mutex
 	speedBuf *buffer.SampleBuffer
-	gustBuf  *buffer.SampleBuffer
 	dirBuf   *buffer.SampleBuffer
-	DirStr   string
-	masthead *i2c.Dev
-	args     *env.Args
+	sps      int // samples per second
+	cfg      *env.Config
+	onGust   atomic.Pointer[func(mph, dir float64)]
+	lastGust float64
+	stop     context.CancelFunc
+	done     chan struct{}
 }
 
-var lastVal float64 = 0
+// masthead is the periph PulseCounter, a micro on the mast counts the anemometer
+// pulses and we read (and reset) the count over I2C.
+type masthead struct {
+	dev *i2c.Dev
+}
 
-func NewAnemometer(bus *i2c.Bus, args *env.Args) *Anemometer {
-	a := &Anemometer{}
-	a.args = args
-	a.Bus = bus
-	a.args.WindEnabled = &env.Disabled
+// adcVane is the periph VaneReader, the vane resistor network is read by an ADS1115.
+type adcVane struct {
+	pin ads1x15.PinADC
+}
 
-	logger.Infof("Starting Masthead I2C [%x] Speed test flag is %v", env.MastHead, *a.args.Speedon)
-	a.masthead = &i2c.Dev{Addr: env.MastHead, Bus: *bus}
+func NewMasthead(bus *i2c.Bus, cfg *env.Config) (*masthead, *adcVane) {
+	logger.Infof("Starting Masthead I2C [%x] Speed test flag is %v", cfg.Sensors.Wind.Masthead, cfg.Flags.Speedon)
+	m := &masthead{dev: &i2c.Dev{Addr: cfg.Sensors.Wind.Masthead, Bus: *bus}}
 
-	logger.Infof("Starting Wind direction ADC I2C [%x] Dir test flag is %v", ads1x15.DefaultOpts.I2cAddress, *a.args.Diron)
-	// Create a new ADS1115 ADC.
-	adc, err := ads1x15.NewADS1115(*a.Bus, &ads1x15.DefaultOpts)
+	vane, err := NewVane(bus, cfg)
 	if err != nil {
 		logger.Error(err)
-		return nil
+		return nil, nil
+	}
+	// check connection
+	if err := m.dev.Tx([]byte{0x00}, make([]byte, 4)); err != nil {
+		logger.Errorf("Masthead did not respond [%v]", err)
+		return nil, nil
+	}
+	return m, vane
+}
+
+// NewVane is the wind direction ADC on its own
+func NewVane(bus *i2c.Bus, cfg *env.Config) (*adcVane, error) {
+	logger.Infof("Starting Wind direction ADC I2C [%x] Dir test flag is %v", cfg.Sensors.Wind.ADC, cfg.Flags.Diron)
+	// Create a new ADS1115 ADC.
+	opts := ads1x15.DefaultOpts
+	opts.I2cAddress = cfg.Sensors.Wind.ADC
+	adc, err := ads1x15.NewADS1115(*bus, &opts)
+	if err != nil {
+		return nil, err
 	}
 
 	// Obtain an analog pin from the ADC.
 	dirPin, err := adc.PinForChannel(ads1x15.Channel3, 5*physic.Volt, 1*physic.Hertz, ads1x15.SaveEnergy)
 	if err != nil {
-		logger.Error(err)
-		return nil
+		return nil, err
 	}
-	a.dirADC = &dirPin
-	// check connection
-	if err := a.masthead.Tx([]byte{0x00}, make([]byte, 4)); err != nil {
-		logger.Errorf("Masthead did not respond [%v]", err)
+	return &adcVane{pin: dirPin}, nil
+}
+
+func (m *masthead) ReadPulses() (uint32, error) {
+	write := []byte{0x00} // we don't need to send any command
+	read := make([]byte, 2)
+	if err := m.dev.Tx(write, read); err != nil {
+		return 0, err
+	}
+	return uint32(read[0]), nil
+}
+
+func (v *adcVane) ReadVolts() (float64, error) {
+	sample, err := v.pin.Read()
+	if err != nil {
+		return 0, err
+	}
+	return float64(sample.V) / float64(physic.Volt), nil
+}
+
+// NewAnemometer starts sampling the wind, it stops when ctx is done or it is closed
+func NewAnemometer(ctx context.Context, pulses PulseCounter, vane VaneReader, cfg *env.Config) *Anemometer {
+	a := &Anemometer{}
+	a.cfg = cfg
+	a.pulses = pulses
+	a.vane = vane
+	cal, err := newVaneTable(cfg.Sensors.Wind.Vane)
+	if err != nil {
+		logger.Errorf("Bad wind vane calibration [%v]", err)
 		return nil
 	}
+	a.cal = cal
 
-	sps := env.WindSamplesPerSecond
-	if *a.args.Test {
-		sps = 1
+	a.sps = env.WindSamplesPerSecond
+	if a.cfg.Flags.Test {
+		a.sps = 1
 	}
-	// 4 samples per sec, for 1 mins = 60 * 4 = 240
-	a.speedBuf = buffer.NewBuffer(sps * env.WindBufferLengthSeconds)
-	// 4 samples per sec, for 1 mins = 60 * 4 = 240
-	a.gustBuf = buffer.NewBuffer(sps * env.WindBufferLengthSeconds)
-	a.dirBuf = buffer.NewBuffer(sps * env.WindBufferLengthSeconds)
-
-	a.monitorWindGPIO()
-	a.args.WindEnabled = &env.Enabled
+	// enough for the longest window, 4 samples per sec for 10 mins = 600 * 4 = 2400
+	seconds := max(cfg.Sensors.Wind.MeanShortSeconds, cfg.Sensors.Wind.MeanLongSeconds, cfg.Sensors.Wind.GustWindowSeconds)
+	a.speedBuf = buffer.NewBuffer(a.sps * seconds)
+	a.dirBuf = buffer.NewBuffer(a.sps * seconds)
+
+	ctx, a.stop = context.WithCancel(ctx)
+	a.monitorWindGPIO(ctx)
 	logger.Info("Wind sensor online")
 	return a
 }
 
-func (a *Anemometer) monitorWindGPIO() {
+func (a *Anemometer) monitorWindGPIO(ctx context.Context) {
 	logger.Info("Starting wind sensor")
 
 	period := time.Millisecond * 1000 / env.WindSamplesPerSecond
-	if *a.args.Test {
+	if a.cfg.Flags.Test {
 		logger.Info("Wind sensor period set to 1 second for test")
 		period = time.Second * 1
 	}
 
+	a.done = make(chan struct{})
 	go func() {
+		defer close(a.done)
 		// record the count every
-		write := []byte{0x00} // we don't need to send any command
-		read := make([]byte, 2)
-		for range time.Tick(period) {
-			if err := a.masthead.Tx(write, read); err != nil {
+		for range clock.Tick(ctx, period) {
+			pulseCount, err := a.pulses.ReadPulses()
+			if err != nil {
 				logger.Errorf("Failed to request count from masthead [%v]", err)
+				// a missed sample shouldn't look like a lull
+				a.add(a.speedBuf.GetLast(), a.dirBuf.GetLast())
+				continue
+			}
+			if mph := float64(pulseCount) * float64(a.sps) * a.cfg.Sensors.Wind.MphPerTick; mph > qc.MaxWindMph {
+				// em interference or switch bounce, not wind
+				logger.Errorf("Pulse count error [%v] is [%.0f] mph", pulseCount, mph)
+				a.add(a.speedBuf.GetLast(), a.dirBuf.GetLast())
+				continue
 			}
-			pulseCount := uint32(read[0])
-			if pulseCount > 25 {
-				logger.Errorf("Pulse count error [%v] [%v] [%b]", pulseCount, read, read)
-				pulseCount = 0
+			// if we have no wind the dir is garbage
+			dir := a.dirBuf.GetLast()
+			if pulseCount > 0 || a.cfg.Flags.Diron {
+				dir = a.readDirection()
 			}
-			a.speedBuf.AddItem(float64(pulseCount))
-			a.gustBuf.AddItem(float64(pulseCount))
-			if pulseCount > 0 || *a.args.Diron {
-				a.dirBuf.AddItem(a.readDirection())
-			} else {
-				// if we have no wind the dir is garbage
-				a.dirBuf.AddItem(a.dirBuf.GetLast())
+			a.add(float64(pulseCount), dir)
+			if f := a.onGust.Load(); f != nil {
+				// the gust changes when there's a new highest, or the old one drops out of the window
+				if mph, dir := a.gust(); mph != a.lastGust {
+					a.lastGust = mph
+					(*f)(mph, dir)
+				}
 			}
-			if *a.args.Speedon {
-				logger.Infof("MPH raw [%.2f], calc [%v] Count read [%v]", (float64(pulseCount) * env.MphPerTick), a.GetSpeed(), pulseCount)
+			if a.cfg.Flags.Speedon {
+				logger.Infof("MPH raw [%.2f], calc [%v] Count read [%v]", (float64(pulseCount) * a.cfg.Sensors.Wind.MphPerTick), a.GetSpeed(), pulseCount)
 			}
 		}
 	}()
 }
 
-func (a *Anemometer) GetSpeed() float64 { // WindBufferLengthSeconds min rolling average
+// add records a sample, only the sampling goroutine adds so it can use GetLast
+func (a *Anemometer) add(pulses, dir float64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.speedBuf.AddItem(pulses)
+	a.dirBuf.AddItem(dir)
+}
+
+// window is a copy of the last seconds of pulse counts and directions, oldest
+// first, taken together so the same index is the same sample
+func (a *Anemometer) window(seconds int) ([]float64, []float64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.speedBuf.Last(seconds * a.sps), a.dirBuf.Last(seconds * a.sps)
+}
+
+// Close stops the sampling, once it returns the masthead isn't read again
+func (a *Anemometer) Close() error {
+	a.stop()
+	<-a.done
+	return nil
+}
+
+// GetSpeed is the short (2 minute) rolling mean, what the wind is doing now
+func (a *Anemometer) GetSpeed() float64 {
+	return a.meanSpeed(a.cfg.Sensors.Wind.MeanShortSeconds)
+}
+
+// GetMeanSpeed is the long (10 minute) rolling mean, the WMO reported wind
+func (a *Anemometer) GetMeanSpeed() float64 {
+	return a.meanSpeed(a.cfg.Sensors.Wind.MeanLongSeconds)
+}
+
+func (a *Anemometer) meanSpeed(seconds int) float64 {
 	// the buffer contains pulse counts.
-	avg, _, _, _ := a.speedBuf.GetAverageMinMaxSum()
-	// avg ticks per 1/env.WindSamplesPerSecond seconds
-	ticksPerSec := avg * env.WindSamplesPerSecond
-	if ticksPerSec < 0 {
-		d, _, _ := a.speedBuf.GetRawData()
-		logger.Errorf("INVALID TicksPerSecond [%v]\n[%v]", ticksPerSec, d)
-		ticksPerSec = 0
-	}
-	// so the avg speed for the last WindBufferLengthSeconds seconds is...
-	speed := env.MphPerTick * float64(ticksPerSec)
-	if speed > 100 {
-		d, _, p := a.speedBuf.GetRawData()
-		logger.Errorf("Speed valculation error [%v] pos [%v]\n%v", speed, p, d)
-		speed = 0
+	pulses := a.speedBuf.Last(seconds * a.sps)
+	sum := 0.0
+	for _, p := range pulses {
+		sum += p
 	}
+	// avg ticks per 1/sps seconds
+	ticksPerSec := sum / float64(len(pulses)) * float64(a.sps)
+	// so the avg speed for the last seconds is...
+	return a.cfg.Sensors.Wind.MphPerTick * ticksPerSec
+}
+
+// GetGust is "the maximum three second average wind speed occurring in any period (10 min)"
+func (a *Anemometer) GetGust() float64 {
+	speed, _ := a.gust()
 	return speed
 }
 
-func (a *Anemometer) GetGust() float64 { // "the maximum three second average wind speed occurring in any period (10 min)"
-	const threeSecond = 3
-	data, s, _ := a.gustBuf.GetRawData()
-	size := int(s)
-	// make an array for the 3 second rolling average
-	threeSecMax := 0.0
-	x := 0.0
+// GetGustDirection is the mean direction during the gust
+func (a *Anemometer) GetGustDirection() float64 {
+	_, dir := a.gust()
+	return dir
+}
+
+func (a *Anemometer) gust() (float64, float64) {
+	wind := a.cfg.Sensors.Wind
+	pulses, dirs := a.window(wind.GustWindowSeconds)
+	n := wind.GustSeconds * a.sps
 
-	for i := 0; i < size; i++ {
-		x = 0
-		for j := 0; j < (env.WindSamplesPerSecond * threeSecond); j++ {
-			x += (data[getWrappedIndex(i+j, size)])
+	// rolling sum of the gust length
+	maxSum, maxAt := -1.0, 0
+	x := 0.0
+	for i := range pulses {
+		x += pulses[i]
+		if i >= n {
+			x -= pulses[i-n]
 		}
-		// x is the 3 second average
-		if x > threeSecMax {
-			threeSecMax = x
+		if i >= n-1 && x > maxSum {
+			maxSum, maxAt = x, i-n+1
 		}
 	}
-	// we still occasionally get stupid values (500MPH)
-	// these are either caused by em interference or by
-	// switch bounce. Either way we need to filter them out
-	// until we can find the root cause and remove it.
-	val := (threeSecMax / threeSecond) * env.MphPerTick
-	if val > 120 {
-		val = lastVal
+	if maxSum < 0 {
+		return 0, dirs[len(dirs)-1]
 	}
-	lastVal = val
-	return val
-}
-
-func getWrappedIndex(x int, size int) int {
-	if x >= size {
-		return x - size
+	val := (maxSum / float64(wind.GustSeconds)) * wind.MphPerTick
+	dir, _, ok := vectorMean(dirs[maxAt:maxAt+n], pulses[maxAt:maxAt+n])
+	if !ok {
+		dir = dirs[maxAt+n-1]
 	}
-	return x
+	return val, dir
 }
 
+// GetDirection is the vector mean direction over the short window
 func (a *Anemometer) GetDirection() float64 {
-	avg, _, _, _ := a.dirBuf.GetAverageMinMaxSum()
-	return float64(avg)
+	deg, _ := a.direction(a.cfg.Sensors.Wind.MeanShortSeconds)
+	return deg
+}
+
+// GetMeanDirection is the vector mean direction over the long window
+func (a *Anemometer) GetMeanDirection() float64 {
+	deg, _ := a.direction(a.cfg.Sensors.Wind.MeanLongSeconds)
+	return deg
+}
+
+// GetDirectionStdDev is how steady the wind direction has been over the long window, 0 is rock steady
+func (a *Anemometer) GetDirectionStdDev() float64 {
+	_, sd := a.direction(a.cfg.Sensors.Wind.MeanLongSeconds)
+	return sd
+}
+
+func (a *Anemometer) GetDirStr() string {
+	return cardinal(a.GetDirection())
+}
+
+func (a *Anemometer) direction(seconds int) (float64, float64) {
+	speeds, dirs := a.window(seconds)
+	var weights []float64
+	if a.cfg.Sensors.Wind.SpeedWeightedDirection {
+		weights = speeds
+	}
+	deg, sd, ok := vectorMean(dirs, weights)
+	if !ok {
+		// the wind has gone all round the compass, there isn't a mean
+		return dirs[len(dirs)-1], sd
+	}
+	return deg, sd
 }
 
 func (a *Anemometer) readDirection() float64 {
-	sample, err := (*a.dirADC).Read()
+	volts, err := a.vane.ReadVolts()
 	if err != nil {
 		logger.Debugf("Error reading wind direction value [%v]", err)
 		return a.dirBuf.GetLast()
 	}
-	deg, str := voltToDegrees(float64(sample.V) / float64(physic.Volt))
-	a.DirStr = str
-	if *a.args.Diron {
-		logger.Infof("Volts [%v], Deg [%v] : %s", float64(sample.V)/float64(physic.Volt), deg, str)
+	deg := a.cal.toDegrees(volts)
+	if a.cfg.Flags.Diron {
+		logger.Infof("Volts [%v], Deg [%v] : %s", volts, deg, cardinal(deg))
 	}
 	return deg
 }
 
-// This should be in an external config file...
-func voltToDegrees(v float64) (float64, string) {
-	// this is based on actual measurements of output voltage for each cardinal point
-	// threhold voltage is midway between the two recorded values.
-	switch {
-	case v < 0.376:
-		return 112.5, "ESE"
-	case v < 0.441:
-		return 67.5, "ENE"
-	case v < 0.548:
-		return 90.0, "E"
-	case v < 0.775:
-		return 157.5, "SSE"
-	case v < 1.069:
-		return 135.0, "SE"
-	case v < 1.324:
-		return 202.5, "SSW"
-	case v < 1.726:
-		return 180.0, "S"
-	case v < 2.161:
-		return 22.5, "NNE"
-	case v < 2.64:
-		return 45.0, "NE"
-	case v < 3.055:
-		return 247.5, "WSW"
-	case v < 3.315:
-		return 225.0, "SW"
-	case v < 3.705:
-		return 337.5, "NNW"
-	case v < 4.013:
-		return 0, "N"
-	case v < 4.258:
-		return 292.5, "WNW"
-	case v < 4.550:
-		return 315.0, "NW"
-	default:
-		return 270.0, "W"
-	}
-}
-
 /*
 Measuring gusts and wind intensity
 
@@ -9,14 +9,14 @@ import (
 )
 
 func Test_anemometer_GetSpeed(t *testing.T) {
+	cfg := env.Default()
 	a := Anemometer{
-		dirADC:   nil,
-		Bus:      nil,
-		speedBuf: buffer.NewBuffer(env.WindSamplesPerSecond * env.WindBufferLengthSeconds),
-		gustBuf:  buffer.NewBuffer(env.WindSamplesPerSecond * env.WindBufferLengthSeconds),
-		dirBuf:   &buffer.SampleBuffer{},
-		masthead: nil,
-		args:     &env.Args{},
+		pulses:   nil,
+		vane:     nil,
+		speedBuf: buffer.NewBuffer(env.WindSamplesPerSecond * 600),
+		dirBuf:   buffer.NewBuffer(env.WindSamplesPerSecond * 600),
+		sps:      env.WindSamplesPerSecond,
+		cfg:      cfg,
 	}
 
 	s := a.GetSpeed()
@@ -24,7 +24,6 @@ func Test_anemometer_GetSpeed(t *testing.T) {
 
 	// the first time a value is set in a buffer, it is filled with that value so easy to populate
 	a.speedBuf.AddItem(float64(1))
-	a.gustBuf.AddItem(float64(1))
 	// 1 pick per 1/4 second with current values.
 
 	avg, _, _, _ := a.speedBuf.GetAverageMinMaxSum()
@@ -37,5 +36,57 @@ func Test_anemometer_GetSpeed(t *testing.T) {
 
 	calc := a.GetSpeed()
 
-	require.Equal(t, float64(ticksSecond*env.MphPerTick), calc)
+	require.Equal(t, float64(ticksSecond)*cfg.Sensors.Wind.MphPerTick, calc)
+}
+
+func Test_anemometer_GetDirection(t *testing.T) {
+	cfg := env.Default()
+	a := Anemometer{
+		speedBuf: buffer.NewBuffer(8),
+		dirBuf:   buffer.NewBuffer(8),
+		sps:      env.WindSamplesPerSecond,
+		cfg:      cfg,
+	}
+	// north wind flicking either side of 0
+	for i := 0; i < 8; i++ {
+		a.speedBuf.AddItem(2)
+		a.dirBuf.AddItem(float64(350 + (i%2)*20))
+	}
+	require.InDelta(t, 0, angleBetween(a.GetDirection(), 0), 0.0001)
+	require.Equal(t, "N", a.GetDirStr())
+	require.InDelta(t, 10, a.GetDirectionStdDev(), 0.5)
+
+	// a calm spell from the west hardly moves it (it pushes out a 350° sample),
+	// unweighted it would swing 7° towards the west
+	a.speedBuf.AddItem(0)
+	a.dirBuf.AddItem(270)
+	require.InDelta(t, 0, angleBetween(a.GetDirection(), 0), 2)
+}
+
+func Test_anemometer_GetGust(t *testing.T) {
+	cfg := env.Default()
+	a := Anemometer{
+		speedBuf: buffer.NewBuffer(env.WindSamplesPerSecond * 600),
+		dirBuf:   buffer.NewBuffer(env.WindSamplesPerSecond * 600),
+		sps:      env.WindSamplesPerSecond,
+		cfg:      cfg,
+	}
+	// a steady 4 ticks a second from the east
+	a.speedBuf.AddItem(1)
+	a.dirBuf.AddItem(90)
+	// a 3 second gust of 20 ticks a second from the south 5 minutes ago
+	for i := 0; i < 3*env.WindSamplesPerSecond; i++ {
+		a.speedBuf.AddItem(5)
+		a.dirBuf.AddItem(180)
+	}
+	for i := 0; i < 300*env.WindSamplesPerSecond; i++ {
+		a.speedBuf.AddItem(1)
+		a.dirBuf.AddItem(90)
+	}
+	require.InDelta(t, 20*cfg.Sensors.Wind.MphPerTick, a.GetGust(), 0.0001)
+	require.InDelta(t, 180, a.GetGustDirection(), 0.0001)
+	// the gust is out of the 2 minute mean but not the 10 minute one
+	require.InDelta(t, 4*cfg.Sensors.Wind.MphPerTick, a.GetSpeed(), 0.0001)
+	require.Greater(t, a.GetMeanSpeed(), a.GetSpeed())
+	require.InDelta(t, 90, a.GetDirection(), 0.0001)
 }
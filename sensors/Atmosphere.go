@@ -1,7 +1,7 @@
 package sensors
 
 import (
-	"flag"
+	"fmt"
 	"math"
 
 	//"github.com/gr-butler/devices/htu21d"
@@ -14,11 +14,6 @@ import (
 	"periph.io/x/devices/v3/mcp9808"
 )
 
-const (
-	MCP9808_I2C = 0x18
-	BME280_I2C  = 0x76
-)
-
 type PressurehPa float64
 type RelHumidity float64
 type TemperatureC float64
@@ -38,26 +33,24 @@ func (t TemperatureC) Float64() float64 {
 type atmosphere struct {
 	PH   *bmxx80.Dev  // BME280 Pressure & humidity
 	Temp *mcp9808.Dev // MCP9808 temperature sensor
-	args *env.Args
+	cfg  *env.Config
 }
 
-func NewAtmosphere(bus *i2c.Bus, args *env.Args) *atmosphere {
+func NewAtmosphere(bus *i2c.Bus, cfg *env.Config) *atmosphere {
 	a := &atmosphere{}
-	a.args = args
-	a.args.RainEnabled = &env.Disabled
+	a.cfg = cfg
 
-	temperatureAddr := flag.Int("address", MCP9808_I2C, "I²C address")
-	logger.Infof("Starting MCP9808 Temperature Sensor [%x]", MCP9808_I2C)
+	logger.Infof("Starting MCP9808 Temperature Sensor [%x]", cfg.Sensors.Atmosphere.MCP9808)
 	// Create a new temperature sensor with hig res
-	tempSensor, err := mcp9808.New(*bus, &mcp9808.Opts{Addr: *temperatureAddr, Res: mcp9808.High})
+	tempSensor, err := mcp9808.New(*bus, &mcp9808.Opts{Addr: int(cfg.Sensors.Atmosphere.MCP9808), Res: mcp9808.High})
 	if err != nil {
 		logger.Errorf("Failed to open MCP9808 sensor: %v", err)
 		a.Temp = nil
 	}
 	a.Temp = tempSensor
 
-	logger.Infof("Starting BME280 reader [%x]", BME280_I2C)
-	bme, err := bmxx80.NewI2C(*bus, BME280_I2C, &bmxx80.DefaultOpts)
+	logger.Infof("Starting BME280 reader [%x]", cfg.Sensors.Atmosphere.BME280)
+	bme, err := bmxx80.NewI2C(*bus, cfg.Sensors.Atmosphere.BME280, &bmxx80.DefaultOpts)
 	if err != nil {
 		logger.Errorf("failed to initialize bme280: %v", err)
 		a.PH = nil
@@ -65,38 +58,41 @@ func NewAtmosphere(bus *i2c.Bus, args *env.Args) *atmosphere {
 	a.PH = bme
 
 	//htu21d.NewI2C(*bus, 0x40, &htu21d.Opts{})
-	if a.PH != nil && a.Temp != nil {
-		logger.Info("Atmospheric sensors online")
-		a.args.RainEnabled = &env.Enabled
+	if a.PH == nil && a.Temp == nil {
+		return nil
+	}
+	if a.PH == nil {
+		// still worth having the temperature
+		logger.Warn("No BME280, pressure and humidity will be missing")
 	}
+	logger.Info("Atmospheric sensors online")
 	return a
 }
 
-func (a *atmosphere) GetHumidityAndPressure() (PressurehPa, RelHumidity) {
+func (a *atmosphere) GetHumidityAndPressure() (PressurehPa, RelHumidity, error) {
 	em := physic.Env{}
 	if a.PH != nil {
 		if err := a.PH.Sense(&em); err != nil {
-			logger.Errorf("BME280 read failed [%v]", err)
-			return 0, 0
+			return 0, 0, fmt.Errorf("BME280 read failed [%w]", err)
 		}
 		// convert raw sensor output
-		if *a.args.Humidity {
+		if a.cfg.Flags.Humidity {
 			logger.Infof("Hum raw [%v]", em.Humidity)
 		}
 		humidity := RelHumidity(math.Round(float64(em.Humidity) / float64(physic.PercentRH)))
 		pressure := PressurehPa(math.Round((float64(em.Pressure)/float64(100*physic.Pascal))*100) / 100)
 
-		return pressure, humidity
+		return pressure, humidity, nil
 	}
-	return 0, 0
+	return 0, 0, fmt.Errorf("no BME280")
 }
 
-func (a *atmosphere) GetTemperature() TemperatureC {
+func (a *atmosphere) GetTemperature() (TemperatureC, error) {
 	hiT := physic.Env{}
 	if a.Temp != nil {
 		err := a.Temp.Sense(&hiT)
 		if err == nil {
-			return TemperatureC(hiT.Temperature.Celsius())
+			return TemperatureC(hiT.Temperature.Celsius()), nil
 		}
 		logger.Errorf("MCP9808 read failed [%v]", err)
 	}
@@ -105,9 +101,9 @@ func (a *atmosphere) GetTemperature() TemperatureC {
 		logger.Warn("MCP9808 offline - falling back to BME280")
 		err := a.PH.Sense(&hiT)
 		if err == nil {
-			return TemperatureC(hiT.Temperature.Celsius())
+			return TemperatureC(hiT.Temperature.Celsius()), nil
 		}
-		logger.Errorf("BME280 fallback read failed [%v]", err)
+		return 0, fmt.Errorf("BME280 fallback read failed [%w]", err)
 	}
-	return 0
+	return 0, fmt.Errorf("no temperature sensor")
 }
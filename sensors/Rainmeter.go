@@ -1,56 +1,60 @@
 package sensors
 
 import (
+	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/gr-butler/weather/buffer"
+	"github.com/gr-butler/weather/clock"
 	"github.com/gr-butler/weather/env"
 	"github.com/gr-butler/weather/led"
 	logger "github.com/sirupsen/logrus"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/gpio/gpioreg"
 	"periph.io/x/conn/v3/gpio/gpioutil"
-	"periph.io/x/conn/v3/i2c"
 )
 
 type rainmeter struct {
-	gpioPin           *gpio.PinIO // Rain bucket tip pin
+	tips              TipDetector // Rain bucket tip
 	dayAccumulation   int64
 	accumulationSince int64
 	ledOut            *led.LED
 	tipBuf            *buffer.SampleBuffer
-	args              *env.Args
+	cfg               *env.Config
+	onTip             atomic.Pointer[func()]
+	stop              context.CancelFunc
 }
 
-type mmHr float64
-type mm float64
+// rainPin is the periph TipDetector, the reed switch on the bucket pulls the pin low.
+type rainPin struct {
+	pin gpio.PinIO
+}
+
+type MmHr float64
+type Mm float64
 
-func (m mmHr) Float64() float64 {
+func (m MmHr) Float64() float64 {
 	return float64(m)
 }
 
-func toMMHr(v float64) mmHr {
-	return mmHr(v)
+func toMMHr(v float64) MmHr {
+	return MmHr(v)
 }
 
-func (m mm) Float64() float64 {
+func (m Mm) Float64() float64 {
 	return float64(m)
 }
 
-func toMM(v int64) mm {
-	return mm(float64(v) * env.MmPerTip)
+func (r *rainmeter) toMM(v int64) Mm {
+	return Mm(float64(v) * r.cfg.Sensors.Rain.MmPerTip)
 }
 
-func NewRainmeter(bus *i2c.Bus, args *env.Args) *rainmeter {
-	r := &rainmeter{}
-	r.args = args
-	r.args.RainEnabled = &env.Disabled
-
+func NewRainPin(cfg *env.Config) *rainPin {
 	// Lookup a rainpin by its number:
-	rp := gpioreg.ByName(env.RainSensorIn)
+	rp := gpioreg.ByName(cfg.Sensors.Rain.Pin)
 	if rp == nil {
-		logger.Errorf("Failed to find %v - rain pin", env.RainSensorIn)
-
+		logger.Errorf("Failed to find %v - rain pin", cfg.Sensors.Rain.Pin)
 		return nil
 	}
 
@@ -63,25 +67,47 @@ func NewRainmeter(bus *i2c.Bus, args *env.Args) *rainmeter {
 		logger.Errorf("Failed to set debounce [%v]", err)
 		return nil
 	}
-	r.gpioPin = &rainpin
+	return &rainPin{pin: rainpin}
+}
+
+func (p *rainPin) WaitForTip() bool {
+	for {
+		if !p.pin.WaitForEdge(-1) {
+			// halted
+			return false
+		}
+		if p.pin.Read() == gpio.Low {
+			return true
+		}
+	}
+}
+
+func (p *rainPin) Halt() error {
+	return p.pin.Halt()
+}
 
-	r.ledOut = led.NewLED("Rain Tip", env.RainTipLed)
+// NewRainmeter starts watching the bucket, it stops when ctx is done or it is closed
+func NewRainmeter(ctx context.Context, tips TipDetector, tipLed *led.LED, cfg *env.Config) *rainmeter {
+	r := &rainmeter{}
+	r.cfg = cfg
+	r.tips = tips
+	r.ledOut = tipLed
 
 	// every minute for last hour = 60
 	r.tipBuf = buffer.NewBuffer(60)
-	r.monitorRainGPIO()
-	r.args.RainEnabled = &env.Enabled
+	ctx, r.stop = context.WithCancel(ctx)
+	r.monitorRainGPIO(ctx)
 	logger.Info("Rain sensor online")
 	return r
 }
 
-func (r *rainmeter) GetRate() mmHr {
+func (r *rainmeter) GetRate() MmHr {
 	_, _, _, sum := r.tipBuf.GetAverageMinMaxSum()
-	return toMMHr(env.MmPerTip * float64(sum))
+	return toMMHr(r.cfg.Sensors.Rain.MmPerTip * float64(sum))
 }
 
-func (r *rainmeter) GetDayAccumulation() mm {
-	return toMM(r.dayAccumulation)
+func (r *rainmeter) GetDayAccumulation() Mm {
+	return r.toMM(r.dayAccumulation)
 }
 
 func (r *rainmeter) ResetDayAccumulation() {
@@ -89,39 +115,45 @@ func (r *rainmeter) ResetDayAccumulation() {
 }
 
 // returns the accumulation since last called.
-func (r *rainmeter) GetAccumulation() mm {
+func (r *rainmeter) GetAccumulation() Mm {
 	a := r.accumulationSince
 	r.accumulationSince = 0
-	return toMM(a)
+	return r.toMM(a)
 }
 
-func (r *rainmeter) monitorRainGPIO() {
+func (r *rainmeter) monitorRainGPIO(ctx context.Context) {
 	logger.Info("Starting tip bucket monitor")
 	rainTip := 0
 	go func() {
-		defer func() { _ = (*r.gpioPin).Halt() }()
-		for {
-			(*r.gpioPin).WaitForEdge(-1)
-			if (*r.gpioPin).Read() == gpio.Low {
-				rainTip += 1             // for rates
-				r.dayAccumulation += 1   // for day
-				r.accumulationSince += 1 // for accumulations
+		for r.tips.WaitForTip() {
+			rainTip += 1             // for rates
+			r.dayAccumulation += 1   // for day
+			r.accumulationSince += 1 // for accumulations
 
-				logger.Infof("Bucket tip. [%v] @ %v (day [%v], since [%v])", rainTip, time.Now().Format(time.ANSIC), r.dayAccumulation, r.accumulationSince)
+			logger.Infof("Bucket tip. [%v] @ %v (day [%v], since [%v])", rainTip, clock.Now().Format(time.ANSIC), r.dayAccumulation, r.accumulationSince)
 
+			if r.ledOut != nil {
 				r.ledOut.Flash()
 			}
+			if f := r.onTip.Load(); f != nil {
+				(*f)()
+			}
 		}
 	}()
 	go func() {
 		// record the count every minute
-		for range time.Tick(time.Minute) {
+		for range clock.Tick(ctx, time.Minute) {
 			r.tipBuf.AddItem(float64(rainTip))
 			rainTip = 0
 		}
 	}()
 }
 
-func (r *rainmeter) GetLED() *led.LED {
-	return r.ledOut
+// Close stops the tip monitor, halts the pin and turns the tip LED off.
+func (r *rainmeter) Close() error {
+	r.stop()
+	if r.ledOut != nil {
+		r.ledOut.Close()
+	}
+	return r.tips.Halt()
 }
@@ -0,0 +1,151 @@
+package sensors
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gr-butler/weather/samplelog"
+	logger "github.com/sirupsen/logrus"
+)
+
+// The recorder wraps the raw devices and writes everything they read to a
+// samplelog so odd behaviour (the 500MPH gusts) can be replayed on a dev machine.
+
+type recorder struct {
+	file   *os.File
+	log    *samplelog.Writer
+	failed sync.Once
+	done   chan bool
+}
+
+type recordingThermometer struct {
+	Thermometer
+	rec *recorder
+}
+
+type recordingBarometer struct {
+	Barometer
+	rec *recorder
+}
+
+type recordingPulses struct {
+	PulseCounter
+	rec *recorder
+}
+
+type recordingVane struct {
+	VaneReader
+	rec *recorder
+}
+
+type recordingTips struct {
+	TipDetector
+	rec *recorder
+}
+
+// Record wraps the hardware so every raw sample read is also written to the log at path.
+func (hw *Hardware) Record(path string) (*Hardware, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	log, err := samplelog.NewWriter(f, time.Now())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	logger.Infof("Recording raw samples to [%v]", path)
+	rec := &recorder{file: f, log: log, done: make(chan bool)}
+	go rec.flush()
+
+	r := *hw
+	if hw.Temp != nil {
+		r.Temp = &recordingThermometer{Thermometer: hw.Temp, rec: rec}
+	}
+	if hw.Atm != nil {
+		r.Atm = &recordingBarometer{Barometer: hw.Atm, rec: rec}
+	}
+	if hw.Pulses != nil {
+		r.Pulses = &recordingPulses{PulseCounter: hw.Pulses, rec: rec}
+	}
+	if hw.Vane != nil {
+		r.Vane = &recordingVane{VaneReader: hw.Vane, rec: rec}
+	}
+	if hw.Tips != nil {
+		r.Tips = &recordingTips{TipDetector: hw.Tips, rec: rec}
+	}
+	r.Closers = append(append([]io.Closer{}, hw.Closers...), rec)
+	return &r, nil
+}
+
+func (rec *recorder) write(r samplelog.Record) {
+	r.Time = time.Now()
+	if err := rec.log.Write(r); err != nil {
+		// don't fill the log at 4 times a second
+		rec.failed.Do(func() { logger.Errorf("Failed to record sample [%v]", err) })
+	}
+}
+
+// flush every few seconds so not much is lost if the station is killed
+func (rec *recorder) flush() {
+	t := time.NewTicker(time.Second * 10)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			_ = rec.log.Flush()
+		case <-rec.done:
+			return
+		}
+	}
+}
+
+func (rec *recorder) Close() error {
+	close(rec.done)
+	if err := rec.log.Flush(); err != nil {
+		rec.file.Close()
+		return err
+	}
+	return rec.file.Close()
+}
+
+func (t *recordingThermometer) GetTemperature() (TemperatureC, error) {
+	temp, err := t.Thermometer.GetTemperature()
+	if err == nil {
+		t.rec.write(samplelog.Record{Kind: samplelog.Temp, Value: temp.Float64()})
+	}
+	return temp, err
+}
+
+func (b *recordingBarometer) GetHumidityAndPressure() (PressurehPa, RelHumidity, error) {
+	p, h, err := b.Barometer.GetHumidityAndPressure()
+	if err == nil {
+		b.rec.write(samplelog.Record{Kind: samplelog.Atmos, Value: p.Float64(), Value2: h.Float64()})
+	}
+	return p, h, err
+}
+
+// the masthead is replayed one read at a time, so the failed reads are
+// recorded too or everything after them would be a read early
+
+func (p *recordingPulses) ReadPulses() (uint32, error) {
+	n, err := p.PulseCounter.ReadPulses()
+	p.rec.write(samplelog.Record{Kind: samplelog.Pulses, Value: float64(n), Failed: err != nil})
+	return n, err
+}
+
+func (v *recordingVane) ReadVolts() (float64, error) {
+	volts, err := v.VaneReader.ReadVolts()
+	v.rec.write(samplelog.Record{Kind: samplelog.Volts, Value: volts, Failed: err != nil})
+	return volts, err
+}
+
+func (t *recordingTips) WaitForTip() bool {
+	tip := t.TipDetector.WaitForTip()
+	if tip {
+		t.rec.write(samplelog.Record{Kind: samplelog.Tip})
+	}
+	return tip
+}
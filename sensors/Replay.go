@@ -0,0 +1,188 @@
+package sensors
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gr-butler/weather/clock"
+	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/samplelog"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+Replay feeds a recorded samplelog back through the Anemometer and rainmeter.
+
+The masthead pulses and vane volts are handed back in the order they were
+recorded, one per read (failed ones fail again), so the wind buffers see exactly
+the same sequence as the station did. The rain tips happen at their recorded time and the temperature
+and pressure reads get the value recorded at that time. Time comes from the clock
+package, so running faster than real time speeds everything up including Reporting.
+*/
+
+var errRecordedFailure = errors.New("the recorded read failed")
+
+type replay struct {
+	lock   sync.Mutex
+	pulses []samplelog.Record
+	volts  []samplelog.Record
+	tips   []time.Time
+	temps  []samplelog.Record
+	atmos  []samplelog.Record
+	end    time.Time
+	ended  sync.Once
+	halted chan bool
+	halt   sync.Once
+}
+
+// ReplayHardware loads the log at path and starts the clock at the start of the recording.
+func ReplayHardware(path string, speed float64, cfg *env.Config) (*Hardware, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lr, err := samplelog.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replay{halted: make(chan bool)}
+	for {
+		rec, err := lr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			logger.Warn("Sample log is truncated, replaying what we have")
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch rec.Kind {
+		case samplelog.Pulses:
+			r.pulses = append(r.pulses, rec)
+		case samplelog.Volts:
+			r.volts = append(r.volts, rec)
+		case samplelog.Tip:
+			r.tips = append(r.tips, rec.Time)
+		case samplelog.Temp:
+			r.temps = append(r.temps, rec)
+		case samplelog.Atmos:
+			r.atmos = append(r.atmos, rec)
+		}
+		r.end = rec.Time
+	}
+	if r.end.IsZero() {
+		return nil, errors.New("sample log is empty")
+	}
+	logger.Infof("Replaying [%v] from %v to %v at %vx: pulses [%v] volts [%v] tips [%v] temps [%v] atmos [%v]",
+		path, lr.Start().Format(time.RFC3339), r.end.Format(time.RFC3339), speed,
+		len(r.pulses), len(r.volts), len(r.tips), len(r.temps), len(r.atmos))
+	clock.Replay(lr.Start(), speed)
+
+	hw := &Hardware{}
+	if cfg.Sensors.Atmosphere.Enabled && len(r.temps) > 0 {
+		hw.Temp = r
+	}
+	if cfg.Sensors.Atmosphere.Enabled && len(r.atmos) > 0 {
+		hw.Atm = r
+	}
+	if cfg.Sensors.Rain.Enabled {
+		hw.Tips = r
+	}
+	if cfg.Sensors.Wind.Enabled && len(r.pulses) > 0 {
+		hw.Pulses = r
+		hw.Vane = r
+	}
+	return hw, nil
+}
+
+func (r *replay) checkEnd() {
+	if clock.Now().After(r.end) {
+		r.ended.Do(func() { logger.Info("Replay finished") })
+	}
+}
+
+// at returns the last record at or before now
+func at(records []samplelog.Record, now time.Time) samplelog.Record {
+	i := sort.Search(len(records), func(i int) bool { return records[i].Time.After(now) })
+	if i > 0 {
+		i--
+	}
+	return records[i]
+}
+
+func (r *replay) GetTemperature() (TemperatureC, error) {
+	r.checkEnd()
+	return TemperatureC(at(r.temps, clock.Now()).Value), nil
+}
+
+func (r *replay) GetHumidityAndPressure() (PressurehPa, RelHumidity, error) {
+	r.checkEnd()
+	rec := at(r.atmos, clock.Now())
+	return PressurehPa(rec.Value), RelHumidity(rec.Value2), nil
+}
+
+func (r *replay) ReadPulses() (uint32, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.pulses) == 0 {
+		r.checkEnd()
+		return 0, nil
+	}
+	p := r.pulses[0]
+	r.pulses = r.pulses[1:]
+	if p.Failed {
+		return 0, errRecordedFailure
+	}
+	return uint32(p.Value), nil
+}
+
+func (r *replay) ReadVolts() (float64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.volts) == 0 {
+		return 0, errors.New("no more recorded volts")
+	}
+	v := r.volts[0]
+	r.volts = r.volts[1:]
+	if v.Failed {
+		return 0, errRecordedFailure
+	}
+	return v.Value, nil
+}
+
+func (r *replay) WaitForTip() bool {
+	for {
+		r.lock.Lock()
+		if len(r.tips) == 0 {
+			r.lock.Unlock()
+			<-r.halted
+			return false
+		}
+		next := r.tips[0]
+		wait := clock.Scale(next.Sub(clock.Now()))
+		if wait <= 0 {
+			r.tips = r.tips[1:]
+			r.lock.Unlock()
+			return true
+		}
+		r.lock.Unlock()
+		select {
+		case <-r.halted:
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *replay) Halt() error {
+	r.halt.Do(func() { close(r.halted) })
+	return nil
+}
@@ -0,0 +1,224 @@
+package sensors
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+Simulated hardware for running the station without a pi.
+
+The values are made up but are meant to look believable on a dashboard:
+
+  - temperature follows a daily curve, coldest around dawn and warmest mid afternoon
+  - pressure drifts slowly about 1013hPa
+  - humidity goes down as the temperature goes up
+  - rain comes in showers, the bucket tips are a poisson process while it's raining
+  - wind speed drifts, with gusts on top, and the masthead pulse counts are poisson
+    sampled from that so the Anemometer buffers see the same sort of data as the real thing
+
+Most of the slowly varying values are Ornstein-Uhlenbeck processes, a random walk that
+is pulled back towards a mean.
+*/
+
+const (
+	simMeanTempC      = 11.0
+	simDailyTempRange = 8.0
+	simMeanPressure   = 1013.0
+	simMeanHumidity   = 78.0
+	simMeanWindMph    = 8.0
+	simPrevailingDir  = 225.0
+	simMeanRainMmHr   = 2.0
+	simHoursBetween   = 8.0  // average dry spell
+	simShowerMinutes  = 40.0 // average shower length
+)
+
+type simulator struct {
+	cfg       *env.Config
+	cal       *vaneTable
+	lock      sync.Mutex
+	rnd       *rand.Rand
+	last      time.Time
+	lastPulse time.Time
+
+	tempNoise  float64
+	pressure   float64
+	windMean   float64
+	windDir    float64
+	turbulence float64
+
+	raining    bool
+	rainRate   float64 // mm/hr
+	halted     chan bool
+	haltedOnce sync.Once
+}
+
+type simAtmosphere struct{ s *simulator }
+type simMasthead struct{ s *simulator }
+type simRain struct{ s *simulator }
+
+// SimulatedHardware returns a Hardware made from the simulator rather than periph drivers.
+func SimulatedHardware(cfg *env.Config) *Hardware {
+	logger.Info("Using simulated sensors")
+	s := &simulator{
+		cfg:       cfg,
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		last:      time.Now(),
+		lastPulse: time.Now(),
+		pressure:  simMeanPressure,
+		windMean:  simMeanWindMph,
+		windDir:   simPrevailingDir,
+		halted:    make(chan bool),
+	}
+
+	hw := &Hardware{}
+	cal, err := newVaneTable(cfg.Sensors.Wind.Vane)
+	if err != nil {
+		// validated at start up so shouldn't happen
+		logger.Errorf("Bad wind vane calibration [%v]", err)
+	}
+	s.cal = cal
+	if cfg.Sensors.Atmosphere.Enabled {
+		atm := &simAtmosphere{s: s}
+		hw.Temp = atm
+		hw.Atm = atm
+	}
+	if cfg.Sensors.Rain.Enabled {
+		hw.Tips = &simRain{s: s}
+	}
+	if cfg.Sensors.Wind.Enabled && cal != nil {
+		m := &simMasthead{s: s}
+		hw.Pulses = m
+		hw.Vane = m
+	}
+	return hw
+}
+
+// ou moves x one step of dt along an Ornstein-Uhlenbeck process with mean mu,
+// standard deviation sd and time constant tau.
+func (s *simulator) ou(x, mu, sd float64, tau, dt time.Duration) float64 {
+	k := dt.Seconds() / tau.Seconds()
+	if k > 1 {
+		k = 1
+	}
+	return x + (mu-x)*k + sd*math.Sqrt(2*k)*s.rnd.NormFloat64()
+}
+
+// poisson returns a poisson distributed count with the given mean (Knuth).
+func (s *simulator) poisson(mean float64) uint32 {
+	if mean <= 0 {
+		return 0
+	}
+	l := math.Exp(-mean)
+	k := uint32(0)
+	p := s.rnd.Float64()
+	for p > l {
+		k++
+		p *= s.rnd.Float64()
+	}
+	return k
+}
+
+// step advances the slowly changing weather to now. Must hold the lock.
+func (s *simulator) step() time.Time {
+	now := time.Now()
+	dt := now.Sub(s.last)
+	if dt <= 0 {
+		return now
+	}
+	s.last = now
+
+	s.tempNoise = s.ou(s.tempNoise, 0, 0.4, 30*time.Minute, dt)
+	s.pressure = s.ou(s.pressure, simMeanPressure, 10, 36*time.Hour, dt)
+	s.windMean = s.ou(s.windMean, simMeanWindMph, 4, time.Hour, dt)
+	if s.windMean < 0 {
+		s.windMean = 0
+	}
+	s.windDir = s.ou(s.windDir, simPrevailingDir, 40, 45*time.Minute, dt)
+	s.turbulence = s.ou(s.turbulence, 0, 0.35, 5*time.Second, dt)
+
+	// showers start and stop at random
+	if s.raining {
+		if s.rnd.Float64() < dt.Minutes()/simShowerMinutes {
+			s.raining = false
+		}
+	} else if s.rnd.Float64() < dt.Hours()/simHoursBetween {
+		s.raining = true
+		s.rainRate = s.rnd.ExpFloat64() * simMeanRainMmHr
+	}
+	return now
+}
+
+func (s *simulator) temperature(now time.Time) float64 {
+	// warmest at 3pm, coldest at 3am
+	hour := float64(now.Hour()) + float64(now.Minute())/60
+	return simMeanTempC + (simDailyTempRange/2)*math.Cos(2*math.Pi*(hour-15)/24) + s.tempNoise
+}
+
+func (a *simAtmosphere) GetTemperature() (TemperatureC, error) {
+	a.s.lock.Lock()
+	defer a.s.lock.Unlock()
+	now := a.s.step()
+	return TemperatureC(math.Round(a.s.temperature(now)*100) / 100), nil
+}
+
+func (a *simAtmosphere) GetHumidityAndPressure() (PressurehPa, RelHumidity, error) {
+	a.s.lock.Lock()
+	defer a.s.lock.Unlock()
+	now := a.s.step()
+	t := a.s.temperature(now)
+	h := simMeanHumidity - 3.5*(t-simMeanTempC) + 2*a.s.rnd.NormFloat64()
+	if a.s.raining {
+		h += 10
+	}
+	h = math.Max(25, math.Min(100, h))
+	return PressurehPa(math.Round(a.s.pressure*100) / 100), RelHumidity(math.Round(h)), nil
+}
+
+func (m *simMasthead) ReadPulses() (uint32, error) {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	now := m.s.step()
+	dt := now.Sub(m.s.lastPulse)
+	m.s.lastPulse = now
+	mph := math.Max(0, m.s.windMean*(1+m.s.turbulence))
+	return m.s.poisson(mph / m.s.cfg.Sensors.Wind.MphPerTick * dt.Seconds()), nil
+}
+
+func (m *simMasthead) ReadVolts() (float64, error) {
+	m.s.lock.Lock()
+	defer m.s.lock.Unlock()
+	m.s.step()
+	return m.s.cal.toVolts(m.s.windDir + 15*m.s.rnd.NormFloat64()), nil
+}
+
+func (r *simRain) WaitForTip() bool {
+	for {
+		select {
+		case <-r.s.halted:
+			return false
+		case <-time.After(time.Second):
+		}
+		r.s.lock.Lock()
+		r.s.step()
+		tip := false
+		if r.s.raining {
+			tipsPerSec := r.s.rainRate / r.s.cfg.Sensors.Rain.MmPerTip / 3600
+			tip = r.s.rnd.Float64() < tipsPerSec
+		}
+		r.s.lock.Unlock()
+		if tip {
+			return true
+		}
+	}
+}
+
+func (r *simRain) Halt() error {
+	r.s.haltedOnce.Do(func() { close(r.s.halted) })
+	return nil
+}
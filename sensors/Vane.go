@@ -0,0 +1,68 @@
+package sensors
+
+import (
+	"math"
+
+	"github.com/gr-butler/weather/env"
+)
+
+// vaneTable turns the vane volts into degrees using the calibration from the config.
+type vaneTable struct {
+	points []env.VanePoint // sorted by volts
+	offset float64
+}
+
+// CompassPoints are the 16 point names, N first, every 22.5°
+var CompassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+func newVaneTable(v env.Vane) (*vaneTable, error) {
+	points, err := v.Points()
+	if err != nil {
+		return nil, err
+	}
+	return &vaneTable{points: points, offset: v.Offset}, nil
+}
+
+// toDegrees returns the point with the nearest measured voltage, so the threshold
+// between two points is midway between them.
+func (t *vaneTable) toDegrees(v float64) float64 {
+	p := t.points[len(t.points)-1]
+	for i := 0; i < len(t.points)-1; i++ {
+		if v < (t.points[i].Volts+t.points[i+1].Volts)/2 {
+			p = t.points[i]
+			break
+		}
+	}
+	return normalise(p.Degrees + t.offset)
+}
+
+// toVolts is the inverse of toDegrees, the measured voltage for the point nearest deg.
+func (t *vaneTable) toVolts(deg float64) float64 {
+	deg = normalise(deg - t.offset)
+	best := t.points[0]
+	for _, p := range t.points {
+		if angleBetween(p.Degrees, deg) < angleBetween(best.Degrees, deg) {
+			best = p
+		}
+	}
+	return best.Volts
+}
+
+// cardinal returns the compass point name for deg.
+func cardinal(deg float64) string {
+	return CompassPoints[int(math.Round(normalise(deg)/22.5))%16]
+}
+
+// normalise puts deg in the range 0 to 360
+func normalise(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+func angleBetween(a, b float64) float64 {
+	d := math.Abs(normalise(a) - normalise(b))
+	return math.Min(d, 360-d)
+}
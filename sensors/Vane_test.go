@@ -0,0 +1,40 @@
+package sensors
+
+import (
+	"testing"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaneTable(t *testing.T) {
+	cal, err := newVaneTable(env.Vane{Model: "misol"})
+	require.NoError(t, err)
+
+	// either side of the old hard coded thresholds
+	require.Equal(t, 112.5, cal.toDegrees(0.1))
+	require.Equal(t, 112.5, cal.toDegrees(0.37))
+	require.Equal(t, 67.5, cal.toDegrees(0.38))
+	require.Equal(t, 0.0, cal.toDegrees(3.9))
+	require.Equal(t, 270.0, cal.toDegrees(4.6))
+	require.Equal(t, 270.0, cal.toDegrees(5))
+	for i := 0; i < 16; i++ {
+		deg := float64(i) * 22.5
+		require.Equal(t, deg, cal.toDegrees(cal.toVolts(deg)))
+	}
+
+	cal, err = newVaneTable(env.Vane{Model: "misol", Offset: -10})
+	require.NoError(t, err)
+	require.Equal(t, 350.0, cal.toDegrees(3.9))
+	require.Equal(t, 3.917, cal.toVolts(350))
+	require.Equal(t, "N", cardinal(350))
+	require.Equal(t, "NNW", cardinal(335))
+
+	_, err = newVaneTable(env.Vane{Table: []env.VanePoint{
+		{Degrees: 0, Volts: 1},
+		{Degrees: 90, Volts: 2},
+		{Degrees: 180, Volts: 2},
+		{Degrees: 270, Volts: 3},
+	}})
+	require.Error(t, err)
+}
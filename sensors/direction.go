@@ -0,0 +1,56 @@
+package sensors
+
+import "math"
+
+// Directions can't be averaged like numbers, 350° and 10° average to 0° not 180°.
+// Each sample is turned into a unit vector (scaled by its weight, the wind speed),
+// the vectors are added up and the mean direction is the direction of the result.
+
+// yamartinoMax is the std dev when the samples cancel out completely
+var yamartinoMax = yamartino(1)
+
+// vectorMean returns the mean of dirs (degrees) and the Yamartino standard
+// deviation, which is 0 for a steady wind and about 104° for no direction at all.
+// weights can be nil, if they are all 0 (calm) the samples are weighted equally.
+// ok is false if there is no sensible mean.
+func vectorMean(dirs []float64, weights []float64) (mean float64, sd float64, ok bool) {
+	if len(dirs) == 0 {
+		return 0, 0, false
+	}
+	total := 0.0
+	for i := range dirs {
+		if weights != nil {
+			total += weights[i]
+		}
+	}
+	if total <= 0 {
+		weights = nil
+		total = float64(len(dirs))
+	}
+
+	var s, c float64
+	for i, d := range dirs {
+		wt := 1.0
+		if weights != nil {
+			wt = weights[i]
+		}
+		r := d * math.Pi / 180
+		s += wt * math.Sin(r)
+		c += wt * math.Cos(r)
+	}
+	s /= total
+	c /= total
+
+	length := math.Hypot(s, c)
+	if length < 1e-9 {
+		return 0, yamartinoMax, false
+	}
+	mean = normalise(math.Atan2(s, c) * 180 / math.Pi)
+	eps := math.Sqrt(math.Max(0, 1-length*length))
+	return mean, yamartino(eps), true
+}
+
+// yamartino, the 1984 single pass estimate of the direction std dev (degrees)
+func yamartino(eps float64) float64 {
+	return math.Asin(eps) * (1 + (2/math.Sqrt(3)-1)*math.Pow(eps, 3)) * 180 / math.Pi
+}
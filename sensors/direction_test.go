@@ -0,0 +1,35 @@
+package sensors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorMean(t *testing.T) {
+	// the reason for all this, a north wind either side of 0
+	mean, sd, ok := vectorMean([]float64{350, 10, 350, 10}, nil)
+	require.True(t, ok)
+	require.InDelta(t, 0, angleBetween(mean, 0), 0.0001)
+	require.InDelta(t, 10, sd, 0.5)
+
+	mean, sd, ok = vectorMean([]float64{90, 90, 90}, nil)
+	require.True(t, ok)
+	require.InDelta(t, 90, mean, 0.0001)
+	require.InDelta(t, 0, sd, 0.0001)
+
+	// the fast samples count for more
+	mean, _, ok = vectorMean([]float64{0, 90}, []float64{3, 1})
+	require.True(t, ok)
+	require.InDelta(t, 18.43, mean, 0.01)
+
+	// calm, all weights 0 so it's a plain average
+	mean, _, ok = vectorMean([]float64{270, 300}, []float64{0, 0})
+	require.True(t, ok)
+	require.InDelta(t, 285, mean, 0.0001)
+
+	// no direction
+	_, sd, ok = vectorMean([]float64{0, 180}, nil)
+	require.False(t, ok)
+	require.InDelta(t, 103.9, sd, 0.1)
+}
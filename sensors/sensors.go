@@ -1,9 +1,12 @@
 package sensors
 
 import (
-	"flag"
+	"context"
+	"fmt"
+	"io"
 
 	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/led"
 	logger "github.com/sirupsen/logrus"
 
 	"periph.io/x/conn/v3/i2c"
@@ -11,39 +14,202 @@ import (
 	"periph.io/x/host/v3"
 )
 
+// Thermometer reports the air temperature.
+type Thermometer interface {
+	GetTemperature() (TemperatureC, error)
+}
+
+// Barometer reports station pressure and relative humidity (the BME280 does both).
+type Barometer interface {
+	GetHumidityAndPressure() (PressurehPa, RelHumidity, error)
+}
+
+// RainGauge reports rain from the tipping bucket.
+type RainGauge interface {
+	GetRate() MmHr
+	GetDayAccumulation() Mm
+	ResetDayAccumulation()
+	GetAccumulation() Mm
+}
+
+// WindSensor reports speed and direction from the anemometer and vane. Speed
+// and direction are the short (2 minute) means, the Mean ones are the long (10
+// minute) means and the gust is the highest 3 second mean in the last 10 minutes.
+type WindSensor interface {
+	GetSpeed() float64
+	GetMeanSpeed() float64
+	GetGust() float64
+	GetGustDirection() float64
+	GetDirection() float64
+	GetMeanDirection() float64
+	GetDirectionStdDev() float64
+	GetDirStr() string
+}
+
+// The raw devices the rain gauge and anemometer are built on. The periph
+// backed drivers are one implementation, anything else (tests, simulators)
+// only has to provide these.
+
+// PulseCounter returns the number of anemometer pulses since the last read.
+type PulseCounter interface {
+	ReadPulses() (uint32, error)
+}
+
+// VaneReader returns the wind vane output voltage.
+type VaneReader interface {
+	ReadVolts() (float64, error)
+}
+
+// TipDetector blocks until the rain bucket tips. It returns false once halted.
+type TipDetector interface {
+	WaitForTip() bool
+	Halt() error
+}
+
+// Hardware is the set of devices the sensors are built from.
+type Hardware struct {
+	Temp    Thermometer
+	Atm     Barometer
+	Pulses  PulseCounter
+	Vane    VaneReader
+	Tips    TipDetector
+	TipLED  *led.LED
+	Closers []io.Closer
+}
+
 type Sensors struct {
-	Atm    *atmosphere
-	Rain   *rainmeter
-	Wind   *Anemometer
-	Closer *i2c.BusCloser
+	Temp   Thermometer
+	Atm    Barometer
+	Rain   RainGauge
+	Wind   WindSensor
+	rain   *rainmeter
+	wind   *Anemometer
+	closer []io.Closer
 }
 
-func InitSensors(args *env.Args) *Sensors {
-	s := &Sensors{}
+// OpenHardware opens the periph drivers for everything enabled in args.
+func OpenHardware(cfg *env.Config) (*Hardware, error) {
+	hw := &Hardware{}
 
 	if _, err := host.Init(); err != nil {
-		logger.Fatalf("Failed to init i2c bus [%v]", err)
-		return nil
+		return nil, fmt.Errorf("failed to init i2c bus [%w]", err)
 	}
-	i2cbus := flag.String("bus", "1", "I²C bus (/dev/i2c-1)")
-	logger.Infof("Opening I2C bus [%v]", i2cbus)
-	closer, err := i2creg.Open(*i2cbus)
+	logger.Infof("Opening I2C bus [%v]", cfg.Sensors.I2CBus)
+	closer, err := i2creg.Open(cfg.Sensors.I2CBus)
 	if err != nil {
-		logger.Fatalf("failed to open I²C: %v", err)
-		_ = closer.Close()
-		return nil
+		return nil, fmt.Errorf("failed to open I²C [%w]", err)
 	}
-	s.Closer = &closer
+	hw.Closers = append(hw.Closers, closer)
 	bus := i2c.Bus(closer)
 
-	if *args.AtmosphericEnabled {
-		s.Atm = NewAtmosphere(&bus, args)
+	if cfg.Sensors.Atmosphere.Enabled {
+		if atm := NewAtmosphere(&bus, cfg); atm != nil {
+			// the BME280 can stand in for the MCP9808, not the other way round
+			hw.Temp = atm
+			if atm.PH != nil {
+				hw.Atm = atm
+			}
+		}
+	}
+	if cfg.Sensors.Rain.Enabled {
+		if tips := NewRainPin(cfg); tips != nil {
+			hw.Tips = tips
+			hw.TipLED = led.NewLED("Rain Tip", cfg.Sensors.Rain.TipLed)
+		}
 	}
-	if *args.RainEnabled {
-		s.Rain = NewRainmeter(&bus, args)
+	if cfg.Sensors.Wind.Enabled {
+		if pulses, vane := NewMasthead(&bus, cfg); pulses != nil {
+			hw.Pulses = pulses
+			hw.Vane = vane
+		}
 	}
-	if *args.WindEnabled {
-		s.Wind = NewAnemometer(&bus, args)
+	return hw, nil
+}
+
+// OpenVane opens only the wind vane ADC, for calibrating it. Close the closer when done.
+func OpenVane(cfg *env.Config) (VaneReader, io.Closer, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, nil, fmt.Errorf("failed to init i2c bus [%w]", err)
+	}
+	closer, err := i2creg.Open(cfg.Sensors.I2CBus)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open I²C [%w]", err)
+	}
+	bus := i2c.Bus(closer)
+	vane, err := NewVane(&bus, cfg)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	return vane, closer, nil
+}
+
+// NewSensors builds the sensors from whatever hardware is present, they run
+// until ctx is done or they are closed.
+func NewSensors(ctx context.Context, hw *Hardware, cfg *env.Config) *Sensors {
+	s := &Sensors{}
+	s.closer = append(s.closer, hw.Closers...)
+
+	s.Temp = hw.Temp
+	s.Atm = hw.Atm
+
+	if hw.Tips != nil {
+		r := NewRainmeter(ctx, hw.Tips, hw.TipLED, cfg)
+		s.Rain = r
+		s.rain = r
+		s.closer = append(s.closer, r)
+	}
+
+	if hw.Pulses != nil && hw.Vane != nil {
+		if a := NewAnemometer(ctx, hw.Pulses, hw.Vane, cfg); a != nil {
+			s.Wind = a
+			s.wind = a
+			s.closer = append(s.closer, a)
+		}
 	}
 	return s
 }
+
+// Available is which sensors are working, the config only says which were wanted
+type Available struct {
+	Temperature bool
+	Atmosphere  bool // pressure and humidity
+	Rain        bool
+	Wind        bool
+}
+
+// Available is which sensors came up, anything missing is reported as Missing
+func (s *Sensors) Available() Available {
+	return Available{
+		Temperature: s.Temp != nil,
+		Atmosphere:  s.Atm != nil,
+		Rain:        s.Rain != nil,
+		Wind:        s.Wind != nil,
+	}
+}
+
+// OnRainTip calls f after every bucket tip
+func (s *Sensors) OnRainTip(f func()) {
+	if s.rain != nil {
+		s.rain.onTip.Store(&f)
+	}
+}
+
+// OnGust calls f whenever the gust changes, with the gust speed (mph) and direction
+func (s *Sensors) OnGust(f func(mph, dir float64)) {
+	if s.wind != nil {
+		s.wind.onGust.Store(&f)
+	}
+}
+
+// Close stops the sensors and releases the hardware.
+func (s *Sensors) Close() error {
+	var err error
+	// last opened, first closed
+	for i := len(s.closer) - 1; i >= 0; i-- {
+		if cerr := s.closer[i].Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/gr-butler/weather/clock"
+	"github.com/gr-butler/weather/data"
+	"github.com/gr-butler/weather/live"
+)
+
+/*
+The live stream, /api/v1/stream (Server-Sent Events) and /api/v1/stream/ws
+(WebSocket). Every observation goes out as an "observation" event, the same as
+/api/v1/current in metric. In between, each bucket tip sends a "rain" event and
+each change in the gust a "gust" event (with the same 10 minute mean wind_speed
+as the observation), so a display can keep up without waiting for the next
+observation.
+*/
+
+func (w *weatherstation) startStream() {
+	w.hub = live.NewHub()
+	w.s.OnRainTip(func() {
+		if w.hub.Len() == 0 {
+			return
+		}
+		last, _ := w.snapshot.Get()
+		w.hub.Publish("rain", w.api.Update(clock.Now(), map[string]data.Reading{
+			"rain_day":  data.Value(w.s.Rain.GetDayAccumulation().Float64()),
+			"rain_rate": checked(w.s.Rain.GetRate().Float64(), last.RainRate),
+		}))
+	})
+	w.s.OnGust(func(mph, dir float64) {
+		if w.hub.Len() == 0 {
+			return
+		}
+		last, _ := w.snapshot.Get()
+		w.hub.Publish("gust", w.api.Update(clock.Now(), map[string]data.Reading{
+			"wind_gust":           checked(mph, last.WindGust),
+			"wind_gust_direction": checked(dir, last.WindGustDir),
+			"wind_speed":          checked(w.s.Wind.GetMeanSpeed(), last.WindSpeed),
+		}))
+	})
+}
+
+// checked is v with the quality QC gave the same reading in the last
+// observation, so the stream doesn't show good what QC has flagged
+func checked(v float64, last data.Reading) data.Reading {
+	r := data.Value(v)
+	if last.Quality == data.Suspect || last.Quality == data.Bad {
+		r.Flag(last.Quality, last.Reason)
+	}
+	return r
+}
+
+// publish sends the latest snapshot to the live clients
+func (w *weatherstation) publish(s data.Snapshot) {
+	if w.hub == nil || w.hub.Len() == 0 {
+		return
+	}
+	conditions, err := w.api.Conditions(current(s), "metric")
+	if err != nil {
+		return
+	}
+	w.hub.Publish("observation", conditions)
+}
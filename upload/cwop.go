@@ -0,0 +1,103 @@
+package upload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gr-butler/weather/aprs"
+	"github.com/gr-butler/weather/env"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+CWOP want a short connection for each observation: connect to an APRS-IS server,
+read its banner, log in, send the packet and hang up. It doesn't acknowledge
+packets, the login reply is all we get back. See the aprs package for the packet.
+*/
+
+// CWOP is the Citizen Weather Observer Program
+type CWOP struct {
+	call     string
+	passcode string
+	server   string
+	lat, lon float64
+	software string
+	interval time.Duration
+}
+
+func NewCWOP(cfg env.CWOP, station env.Station, software string) *CWOP {
+	return &CWOP{
+		call:     strings.ToUpper(cfg.Callsign),
+		passcode: cfg.Passcode,
+		server:   cfg.Server,
+		lat:      station.Latitude,
+		lon:      station.Longitude,
+		software: software,
+		interval: time.Duration(cfg.FreqMin) * time.Minute,
+	}
+}
+
+func (c *CWOP) Name() string { return "cwop" }
+
+func (c *CWOP) Interval() time.Duration { return c.interval }
+
+// packet is the APRS weather report for o
+func (c *CWOP) packet(o Observation) string {
+	return aprs.Packet(c.call, aprs.Weather{
+		Time:      o.Time,
+		Latitude:  c.lat,
+		Longitude: c.lon,
+		WindDir:   o.WindDir,
+		WindMph:   o.WindSpeedMph,
+		GustMph:   o.WindGustMph,
+		TempF:     convert(o.TempC, cToF),
+		// the rain day starts at 9am not midnight so that isn't sent
+		RainHourIn:  convert(o.RainRate, mmToIn),
+		Humidity:    o.Humidity,
+		PressureHpa: o.MSLPHpa,
+	}, "."+c.software)
+}
+
+func (c *CWOP) Upload(ctx context.Context, o Observation) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// reads don't see ctx, hang up when it's done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	r := bufio.NewReader(conn)
+
+	// the server says hello first
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("no banner from [%v] [%w]", c.server, err)
+	}
+	name, version := c.software, ""
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		name, version = name[:i], name[i+1:]
+	}
+	if _, err := fmt.Fprintf(conn, "%v\r\n", aprs.Login(c.call, c.passcode, name, version)); err != nil {
+		return err
+	}
+	resp, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no login reply from [%v] [%w]", c.server, err)
+	}
+	resp = strings.TrimSpace(resp)
+	if !strings.HasPrefix(resp, "# logresp") {
+		return fmt.Errorf("unexpected login reply [%v]", resp)
+	}
+	packet := c.packet(o)
+	logger.Infof("Sending data to CWOP [%v]", packet)
+	_, err = fmt.Fprintf(conn, "%v\r\n", packet)
+	return err
+}
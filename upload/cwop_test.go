@@ -0,0 +1,64 @@
+package upload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCWOP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// a pretend APRS-IS server, it sends back what it was sent
+	got := make(chan []string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var lines []string
+			r := bufio.NewReader(conn)
+			fmt.Fprint(conn, "# aprsc 2.1.14\r\n")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				line = strings.TrimRight(line, "\r\n")
+				if strings.HasPrefix(line, "user ") {
+					fmt.Fprint(conn, "# logresp EW1234 unverified, server TEST\r\n")
+				}
+				lines = append(lines, line)
+			}
+			conn.Close()
+			got <- lines
+		}
+	}()
+
+	c := NewCWOP(env.CWOP{Callsign: "ew1234", Passcode: "-1", Server: l.Addr().String(), FreqMin: 10},
+		env.Station{Latitude: 50.5, Longitude: -3.5}, "GRB-Weather-2.2.0")
+	require.Equal(t, 10*time.Minute, c.Interval())
+
+	o := testObservation()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.Upload(ctx, o))
+	require.Equal(t, []string{
+		"user EW1234 pass -1 vers GRB-Weather 2.2.0",
+		"EW1234>APRS,TCPIP*:@011015z5030.00N/00330.00W_090/005g010t068r010h50b10029.GRB-Weather-2.2.0",
+	}, <-got)
+
+	// nothing listening
+	l.Close()
+	require.Error(t, c.Upload(ctx, o))
+}
@@ -0,0 +1,60 @@
+package upload
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// ptr is for the optional values in an observation
+func ptr(v float64) *float64 { return &v }
+
+// testObservation has everything set, tests take out what they want missing
+func testObservation() Observation {
+	return Observation{
+		Time:         time.Date(2025, 3, 1, 10, 15, 0, 0, time.UTC),
+		TempC:        ptr(20),
+		Humidity:     ptr(50),
+		DewPointC:    ptr(10),
+		PressureHpa:  ptr(1000),
+		MSLPHpa:      ptr(1002.88),
+		RainMM:       2.54,
+		RainRate:     ptr(2.54),
+		RainDayMM:    ptr(25.4),
+		WindSpeedMph: ptr(5),
+		WindDir:      ptr(90),
+		WindGustMph:  ptr(10),
+	}
+}
+
+// fakeServer is a pretend weather network, it keeps the last request it was
+// sent and answers with status, header and reply
+type fakeServer struct {
+	*httptest.Server
+	status int
+	header http.Header
+	reply  string
+
+	path  string
+	query url.Values
+	body  []byte
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{status: http.StatusOK, header: http.Header{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.path = r.URL.Path
+		s.query = r.URL.Query()
+		s.body, _ = io.ReadAll(r.Body)
+		for k, v := range s.header {
+			rw.Header()[k] = v
+		}
+		rw.WriteHeader(s.status)
+		_, _ = rw.Write([]byte(s.reply))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
@@ -0,0 +1,473 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/gr-butler/weather/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+Sends the observations on to the weather networks (the Met Office WOW and
+friends). Each network is an Uploader, the Manager decides when each one is due,
+keeps its rain total, retries it when it fails and counts how it's doing.
+
+Every observation goes to Observe. A network gets one when its interval comes
+round (on the clock, so every 15 minutes is :00, :15, :30 and :45) with the rain
+since its last successful upload, so nothing is lost while a site is down.
+Uploads run in the background, a slow site never holds up the station.
+
+A network that takes old observations (WOW does) can have a backlog instead, see
+AddQueued. Then each observation only has the rain since the one before it and
+any that fail are kept in a queue on disk, to go oldest first when it's back.
+*/
+
+const (
+	// tries per observation, after that it waits for the next one
+	maxAttempts = 3
+	timeout     = 30 * time.Second
+)
+
+// first wait before trying again, it doubles each time (a var for the tests)
+var retryDelay = 10 * time.Second
+
+var promUploads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "uploads_total",
+		Help: "Uploads to the weather networks, by result",
+	},
+	[]string{"service", "result"},
+)
+
+var promLastUpload = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "upload_last_success_seconds",
+		Help: "Unix time of the last successful upload",
+	},
+	[]string{"service"},
+)
+
+var promBacklog = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "upload_backlog",
+		Help: "Observations waiting to be sent",
+	},
+	[]string{"service"},
+)
+
+func init() {
+	prometheus.MustRegister(promUploads, promLastUpload, promBacklog)
+}
+
+// Observation is what gets uploaded, in the station's units (C, hPa, mm and mph).
+// Anything missing or that failed QC is nil.
+type Observation struct {
+	Time         time.Time // when the sensors were read
+	TempC        *float64
+	Humidity     *float64
+	DewPointC    *float64
+	PressureHpa  *float64 // at the station
+	MSLPHpa      *float64
+	RainMM       float64 // since the last upload
+	RainDayMM    *float64
+	RainRate     *float64 // mm/hr, worked out from the tips in the last hour
+	WindSpeedMph *float64
+	WindDir      *float64
+	WindGustMph  *float64
+	WindGustDir  *float64
+}
+
+// Uploader sends observations to one weather network
+type Uploader interface {
+	// Name is for the logs, metrics and the state file
+	Name() string
+	// Interval is how often it wants an observation
+	Interval() time.Duration
+	// Upload sends one, an error means it didn't get there
+	Upload(ctx context.Context, o Observation) error
+}
+
+type permanent struct{ error }
+
+func (p permanent) Unwrap() error { return p.error }
+
+// Permanent marks an error that trying again won't fix, eg a bad password
+func Permanent(err error) error {
+	return permanent{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanent
+	return errors.As(err, &p)
+}
+
+type rejected struct{ error }
+
+func (r rejected) Unwrap() error { return r.error }
+
+// Rejected is a Permanent error about the observation itself, eg bad data,
+// rather than the network or our details
+func Rejected(err error) error {
+	return permanent{rejected{err}}
+}
+
+func isRejected(err error) bool {
+	var r rejected
+	return errors.As(err, &r)
+}
+
+type backoff struct {
+	error
+	until time.Time
+}
+
+func (b backoff) Unwrap() error { return b.error }
+
+// Backoff is an error that will go away but the network wants to be left alone
+// until then, eg it's rate limiting us. Nothing is sent to it before until, the
+// observations in between are skipped and their rain goes with the next one.
+func Backoff(err error, until time.Time) error {
+	return backoff{err, until}
+}
+
+func isBackoff(err error) bool {
+	var b backoff
+	return errors.As(err, &b)
+}
+
+var errBackingOff = errors.New("backing off")
+
+// service is an uploader and where it's up to
+type service struct {
+	u    Uploader
+	lock sync.Mutex
+	rain float64   // since the last successful upload
+	slot time.Time // interval the last observation was in
+	next chan Observation
+	// nothing is sent before this, only used from run
+	until time.Time
+	// failed observations, oldest first, nil if it doesn't have one
+	backlog *queue.Queue[Observation]
+}
+
+// Manager runs the uploaders
+type Manager struct {
+	path     string
+	services []*service
+	running  sync.WaitGroup
+}
+
+// state is saved between runs so the rain isn't lost
+type state struct {
+	RainMM float64 `json:"rain_mm"`
+}
+
+// NewManager keeps the rain totals in the file at path
+func NewManager(path string) *Manager {
+	return &Manager{path: path}
+}
+
+// Add an uploader, before Start
+func (m *Manager) Add(u Uploader) {
+	m.services = append(m.services, &service{u: u, next: make(chan Observation, 1)})
+	logger.Infof("Uploading to [%v] every [%v]", u.Name(), u.Interval())
+}
+
+// Shortest is the shortest interval of any uploader, 0 if there are none
+func (m *Manager) Shortest() time.Duration {
+	var d time.Duration
+	for _, s := range m.services {
+		if d == 0 || s.u.Interval() < d {
+			d = s.u.Interval()
+		}
+	}
+	return d
+}
+
+// AddQueued adds an uploader that takes old observations, the ones it can't
+// send wait in a queue at path until it can
+func (m *Manager) AddQueued(u Uploader, path string) error {
+	backlog, err := queue.Open[Observation](path)
+	if err != nil {
+		return err
+	}
+	m.Add(u)
+	m.services[len(m.services)-1].backlog = backlog
+	if n := backlog.Len(); n > 0 {
+		logger.Infof("[%v] observations waiting for [%v]", n, u.Name())
+	}
+	promBacklog.WithLabelValues(u.Name()).Set(float64(backlog.Len()))
+	return nil
+}
+
+// Start loads the saved state and runs the uploaders until ctx is done
+func (m *Manager) Start(ctx context.Context) {
+	m.load()
+	for _, s := range m.services {
+		m.running.Add(1)
+		go func() {
+			defer m.running.Done()
+			s.run(ctx)
+		}()
+	}
+}
+
+// Wait for the uploaders to stop once the Start ctx is done, or until this ctx is
+func (m *Manager) Wait(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Observe hands over the latest observation, its RainMM is the rain since the last one
+func (m *Manager) Observe(o Observation) {
+	for _, s := range m.services {
+		s.lock.Lock()
+		s.rain += o.RainMM
+		slot := o.Time.Truncate(s.u.Interval())
+		// the first one only says where we are, don't send straight away after a restart
+		due := !s.slot.IsZero() && slot.After(s.slot)
+		s.slot = slot
+		s.lock.Unlock()
+		if !due {
+			continue
+		}
+		// only the newest matters, one still waiting is replaced
+		select {
+		case <-s.next:
+		default:
+		}
+		s.next <- o
+	}
+}
+
+func (m *Manager) load() {
+	f, err := os.Open(m.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Errorf("Failed to load the upload state [%v]", err)
+		return
+	}
+	defer f.Close()
+	saved := map[string]state{}
+	if err := json.NewDecoder(f).Decode(&saved); err != nil {
+		logger.Errorf("Failed to load the upload state [%v]", err)
+		return
+	}
+	for _, s := range m.services {
+		s.rain += saved[s.u.Name()].RainMM
+	}
+}
+
+// Save writes the rain totals so they can carry on after a restart
+func (m *Manager) Save() error {
+	saved := map[string]state{}
+	for _, s := range m.services {
+		s.lock.Lock()
+		saved[s.u.Name()] = state{RainMM: s.rain}
+		s.lock.Unlock()
+	}
+	js, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, js, 0o644)
+}
+
+func (s *service) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case o := <-s.next:
+			s.send(ctx, o)
+		}
+	}
+}
+
+// upload sends o once, unless it's backing off, and counts how it went
+func (s *service) upload(ctx context.Context, o Observation) error {
+	name := s.u.Name()
+	if time.Now().Before(s.until) {
+		promUploads.WithLabelValues(name, "skipped").Inc()
+		logger.Debugf("Not uploading to [%v] until %v", name, s.until.Format(time.RFC3339))
+		return Backoff(errBackingOff, s.until)
+	}
+	uctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := s.u.Upload(uctx, o); err != nil {
+		var b backoff
+		if errors.As(err, &b) {
+			s.until = b.until
+			promUploads.WithLabelValues(name, "backoff").Inc()
+			logger.Warnf("Backing off [%v] until %v [%v]", name, b.until.Format(time.RFC3339), err)
+			return err
+		}
+		promUploads.WithLabelValues(name, "failed").Inc()
+		return err
+	}
+	promUploads.WithLabelValues(name, "ok").Inc()
+	promLastUpload.WithLabelValues(name).Set(float64(time.Now().Unix()))
+	logger.Infof("Uploaded to [%v] the observation at %v", name, o.Time.Format(time.RFC3339))
+	return nil
+}
+
+// took takes rain that has gone (or is queued) off the total, more may have
+// fallen while we were sending
+func (s *service) took(rain float64) {
+	s.lock.Lock()
+	s.rain -= rain
+	s.lock.Unlock()
+}
+
+// send uploads o, trying again a couple of times unless a newer one turns up
+func (s *service) send(ctx context.Context, o Observation) {
+	if s.backlog != nil {
+		s.sendQueued(ctx, o)
+		return
+	}
+	name := s.u.Name()
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		s.lock.Lock()
+		o.RainMM = s.rain
+		s.lock.Unlock()
+
+		err := s.upload(ctx, o)
+		if err == nil {
+			s.took(o.RainMM)
+			return
+		}
+		if isBackoff(err) {
+			// the rain goes with the first one after it
+			return
+		}
+		if isPermanent(err) || attempt == maxAttempts {
+			logger.Errorf("Failed to upload to [%v] [%v]", name, err)
+			return
+		}
+		logger.Warnf("Failed to upload to [%v], trying again in %v [%v]", name, delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if len(s.next) > 0 {
+			// the next one will carry the rain
+			return
+		}
+		delay *= 2
+	}
+}
+
+// sendQueued is send with a backlog, o has the rain since the last observation
+// and goes after anything already waiting, if it fails it waits too (unless it
+// was Rejected). The backlog is tried again with the next observation.
+func (s *service) sendQueued(ctx context.Context, o Observation) {
+	name := s.u.Name()
+	s.lock.Lock()
+	o.RainMM = s.rain
+	s.lock.Unlock()
+
+	if s.drain(ctx) {
+		err := s.upload(ctx, o)
+		if err == nil {
+			s.took(o.RainMM)
+			return
+		}
+		switch {
+		case isRejected(err):
+			// it will never go, the rain goes with the next one
+			logger.Errorf("Failed to upload to [%v] [%v]", name, err)
+			return
+		case isPermanent(err):
+			// eg a changed pin, keep it for when that's sorted out
+			logger.Errorf("Failed to upload to [%v], queued for later [%v]", name, err)
+		case !isBackoff(err):
+			logger.Warnf("Failed to upload to [%v], queued for later [%v]", name, err)
+		}
+	}
+	if err := s.backlog.Push(o); err != nil {
+		logger.Errorf("Failed to queue the observation for [%v] [%v]", name, err)
+		return
+	}
+	s.took(o.RainMM)
+	promBacklog.WithLabelValues(name).Set(float64(s.backlog.Len()))
+}
+
+// drain sends the backlog oldest first until one fails, true if it's empty
+func (s *service) drain(ctx context.Context) bool {
+	if s.backlog.Len() == 0 {
+		return true
+	}
+	name := s.u.Name()
+	sent, err := s.backlog.Drain(func(o Observation) error {
+		err := s.upload(ctx, o)
+		if isRejected(err) {
+			// don't let one it will never take hold up the rest
+			logger.Errorf("Dropping the observation at %v for [%v] [%v]", o.Time.Format(time.RFC3339), name, err)
+			return nil
+		}
+		// anything else, even a bad pin, stops here and keeps the rest
+		return err
+	})
+	left := s.backlog.Len()
+	promBacklog.WithLabelValues(name).Set(float64(left))
+	if sent > 0 {
+		logger.Infof("Sent [%v] queued observations to [%v], [%v] left", sent, name, left)
+	}
+	if err != nil && !isBackoff(err) {
+		logger.Warnf("Failed to upload the backlog to [%v], [%v] waiting [%v]", name, left, err)
+	}
+	return left == 0
+}
+
+// redact hides the keys in s. The networks want the key or pin in the url,
+// so it turns up in what we log and in the http client's errors.
+func redact(s string, keys ...string) string {
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, k, "****")
+		s = strings.ReplaceAll(s, url.QueryEscape(k), "****")
+	}
+	return s
+}
+
+// unit conversions for the uploaders, nil stays nil
+
+func convert(v *float64, f func(float64) float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	c := f(*v)
+	return &c
+}
+
+func cToF(c float64) float64 { return c*9/5 + 32 }
+
+func mmToIn(mm float64) float64 { return mm / env.MmToInch }
+
+func hPaToInHg(p float64) float64 { return p * env.HPaToInHg }
+
+func mphToMs(mph float64) float64 { return mph * 0.44704 }
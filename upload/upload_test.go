@@ -0,0 +1,248 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+type fakeUploader struct {
+	lock  sync.Mutex
+	fail  []error // returned in turn, then nil
+	calls chan Observation
+}
+
+func newFake(fail ...error) *fakeUploader {
+	return &fakeUploader{fail: fail, calls: make(chan Observation, 10)}
+}
+
+func (f *fakeUploader) Name() string            { return "fake" }
+func (f *fakeUploader) Interval() time.Duration { return 15 * time.Minute }
+
+func (f *fakeUploader) Upload(ctx context.Context, o Observation) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls <- o
+	if len(f.fail) > 0 {
+		err := f.fail[0]
+		f.fail = f.fail[1:]
+		return err
+	}
+	return nil
+}
+
+func (f *fakeUploader) next(t *testing.T) Observation {
+	select {
+	case o := <-f.calls:
+		return o
+	case <-time.After(time.Second):
+		t.Fatal("no upload")
+		return Observation{}
+	}
+}
+
+func (f *fakeUploader) none(t *testing.T) {
+	select {
+	case o := <-f.calls:
+		t.Fatalf("unexpected upload of %v", o.Time)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// observe sends a minute's observation with 0.1mm of rain
+func observe(m *Manager, at time.Time) {
+	m.Observe(Observation{Time: at, RainMM: 0.1})
+}
+
+func TestManager(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := newFake()
+	m := NewManager(filepath.Join(t.TempDir(), "state.json"))
+	m.Add(f)
+	m.Start(ctx)
+
+	start := time.Date(2025, 3, 1, 10, 7, 0, 0, time.UTC)
+	for i := range 8 {
+		observe(m, start.Add(time.Duration(i)*time.Minute))
+	}
+	// not on start up, only when the interval comes round
+	f.none(t)
+
+	observe(m, start.Add(8*time.Minute)) // 10:15
+	o := f.next(t)
+	require.Equal(t, start.Add(8*time.Minute), o.Time)
+	// everything since we started
+	require.InDelta(t, 0.9, o.RainMM, 0.0001)
+
+	for i := range 14 {
+		observe(m, start.Add(time.Duration(9+i)*time.Minute))
+	}
+	f.none(t)
+	observe(m, start.Add(23*time.Minute)) // 10:30
+	require.InDelta(t, 1.5, f.next(t).RainMM, 0.0001)
+}
+
+func TestManagerRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	down := errors.New("connection refused")
+	f := newFake(down, down)
+	path := filepath.Join(t.TempDir(), "state.json")
+	m := NewManager(path)
+	m.Add(f)
+	m.Start(ctx)
+
+	at := time.Date(2025, 3, 1, 10, 14, 0, 0, time.UTC)
+	observe(m, at)
+	observe(m, at.Add(time.Minute))
+	// fails twice then gets there
+	for range 3 {
+		require.InDelta(t, 0.2, f.next(t).RainMM, 0.0001)
+	}
+
+	// gives up after a bad password, the rain waits for the next one
+	f.lock.Lock()
+	f.fail = []error{Permanent(errors.New("bad pin"))}
+	f.lock.Unlock()
+	for i := range 15 {
+		observe(m, at.Add(time.Duration(2+i)*time.Minute))
+	}
+	require.InDelta(t, 1.5, f.next(t).RainMM, 0.0001)
+	f.none(t)
+
+	// and it's kept over a restart
+	cancel()
+	require.NoError(t, m.Wait(context.Background()))
+	require.NoError(t, m.Save())
+	f = newFake()
+	m = NewManager(path)
+	m.Add(f)
+	m.Start(context.Background())
+	observe(m, at.Add(29*time.Minute))
+	observe(m, at.Add(31*time.Minute))
+	require.InDelta(t, 1.7, f.next(t).RainMM, 0.0001)
+}
+
+func TestManagerBacklog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	down := errors.New("connection refused")
+	f := newFake(down, down)
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	m := NewManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, m.AddQueued(f, path))
+	m.Start(ctx)
+
+	at := time.Date(2025, 3, 1, 10, 14, 0, 0, time.UTC)
+	observe(m, at)
+	observe(m, at.Add(time.Minute)) // 10:15
+	// no retries, it's queued
+	require.InDelta(t, 0.2, f.next(t).RainMM, 0.0001)
+	f.none(t)
+
+	for i := range 15 {
+		observe(m, at.Add(time.Duration(2+i)*time.Minute))
+	}
+	// 10:30, the oldest goes first and as that fails the new one waits behind it
+	require.Equal(t, at.Add(time.Minute), f.next(t).Time)
+	f.none(t)
+	backlog := m.services[0].backlog
+	require.Eventually(t, func() bool { return backlog.Len() == 2 }, time.Second, time.Millisecond)
+
+	// still there after a restart
+	cancel()
+	f = newFake()
+	m = NewManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, m.AddQueued(f, path))
+	m.Start(context.Background())
+	observe(m, at.Add(30*time.Minute))
+	observe(m, at.Add(31*time.Minute)) // 10:45
+
+	// oldest first, each with its own time and rain
+	o := f.next(t)
+	require.Equal(t, at.Add(time.Minute), o.Time)
+	require.InDelta(t, 0.2, o.RainMM, 0.0001)
+	o = f.next(t)
+	require.Equal(t, at.Add(16*time.Minute), o.Time)
+	require.InDelta(t, 1.5, o.RainMM, 0.0001)
+	o = f.next(t)
+	require.Equal(t, at.Add(31*time.Minute), o.Time)
+	require.InDelta(t, 0.2, o.RainMM, 0.0001)
+	require.Eventually(t, func() bool { return m.services[0].backlog.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestManagerBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := newFake(Backoff(errors.New("too many"), time.Now().Add(time.Hour)))
+	m := NewManager(filepath.Join(t.TempDir(), "state.json"))
+	m.Add(f)
+	m.Start(ctx)
+
+	at := time.Date(2025, 3, 1, 10, 14, 0, 0, time.UTC)
+	observe(m, at)
+	observe(m, at.Add(time.Minute))
+	// not tried again
+	require.InDelta(t, 0.2, f.next(t).RainMM, 0.0001)
+	f.none(t)
+
+	// and nothing is sent until it's over
+	for i := range 15 {
+		observe(m, at.Add(time.Duration(2+i)*time.Minute))
+	}
+	f.none(t)
+	m.services[0].lock.Lock()
+	require.InDelta(t, 1.7, m.services[0].rain, 0.0001)
+	m.services[0].lock.Unlock()
+}
+
+func TestManagerBacklogPermanent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	badPin := Permanent(errors.New("401 Unauthorized"))
+	f := newFake(errors.New("connection refused"), badPin, Rejected(errors.New("400 Bad Request")))
+	m := NewManager(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, m.AddQueued(f, filepath.Join(t.TempDir(), "queue.jsonl")))
+	m.Start(ctx)
+	backlog := m.services[0].backlog
+
+	at := time.Date(2025, 3, 1, 10, 14, 0, 0, time.UTC)
+	observe(m, at)
+	observe(m, at.Add(time.Minute)) // 10:15
+	f.next(t)
+	require.Eventually(t, func() bool { return backlog.Len() == 1 }, time.Second, time.Millisecond)
+
+	// a bad pin keeps the backlog, and the new one joins it
+	observe(m, at.Add(16*time.Minute)) // 10:30
+	require.Equal(t, at.Add(time.Minute), f.next(t).Time)
+	f.none(t)
+	require.Eventually(t, func() bool { return backlog.Len() == 2 }, time.Second, time.Millisecond)
+
+	// one it won't take is dropped, the rest go
+	observe(m, at.Add(31*time.Minute)) // 10:45
+	require.Equal(t, at.Add(time.Minute), f.next(t).Time)
+	require.Equal(t, at.Add(16*time.Minute), f.next(t).Time)
+	require.Equal(t, at.Add(31*time.Minute), f.next(t).Time)
+	require.Eventually(t, func() bool { return backlog.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestRedact(t *testing.T) {
+	require.Equal(t, "ID=IDEVON1&PASSWORD=****", redact("ID=IDEVON1&PASSWORD=s3cret", "s3cret"))
+	// as it is in the query string
+	require.Equal(t, `Get "https://wow/?siteAuthenticationKey=****": refused`, redact(`Get "https://wow/?siteAuthenticationKey=a+b%2F": refused`, "a b/"))
+	require.Equal(t, "nothing", redact("nothing", ""))
+}
@@ -0,0 +1,187 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+
+https://community.windy.com/topic/8168/report-your-weather-station-data-to-windy
+
+A POST of json to https://stations.windy.com/pws/update/<API key> with the station
+details and the observations, in metric: temp and dewpoint C, wind and gust m/s,
+winddir degrees, humidity %, pressure Pa and precip mm in the last hour.
+
+{
+  "stations": [{"station": 0, "name": "...", "lat": 50.5, "lon": -3.5, "elevation": 24, "tempheight": 2, "windheight": 10}],
+  "observations": [{"station": 0, "dateutc": "2025-03-01T10:15:00", "temp": 20.1, "wind": 2.2, ...}]
+}
+
+It wants no more than one every 5 minutes. 400 is bad data and 401 a bad key, it
+answers too many (or too soon) with 429 or 409, possibly with a Retry-After.
+
+*/
+
+const windyUrl = "https://stations.windy.com/pws/update/"
+
+const (
+	// how long to wait after the first failure, it doubles each time after that
+	windyBackoff    = time.Minute
+	windyMaxBackoff = time.Hour
+)
+
+type windyStation struct {
+	Station     int     `json:"station"`
+	Name        string  `json:"name,omitempty"`
+	ShareOption string  `json:"shareOption,omitempty"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Elevation   float64 `json:"elevation"`
+	TempHeight  float64 `json:"tempheight,omitempty"`
+	WindHeight  float64 `json:"windheight,omitempty"`
+}
+
+// windyObservation is one observation, anything that failed QC is nil and left out
+type windyObservation struct {
+	Station  int      `json:"station"`
+	DateUTC  string   `json:"dateutc"`
+	Temp     *float64 `json:"temp,omitempty"`
+	Wind     *float64 `json:"wind,omitempty"`
+	Gust     *float64 `json:"gust,omitempty"`
+	WindDir  *float64 `json:"winddir,omitempty"`
+	Humidity *float64 `json:"humidity,omitempty"`
+	DewPoint *float64 `json:"dewpoint,omitempty"`
+	Pressure *float64 `json:"pressure,omitempty"`
+	Precip   *float64 `json:"precip,omitempty"`
+}
+
+type windyData struct {
+	Stations     []windyStation     `json:"stations,omitempty"`
+	Observations []windyObservation `json:"observations"`
+}
+
+// Windy is windy.com. A failed upload backs off rather than being tried again
+// straight away, the manager leaves it alone until then.
+type Windy struct {
+	station  windyStation
+	key      string
+	interval time.Duration
+	url      string
+	client   *http.Client
+
+	// only used from the uploader's goroutine
+	registered bool          // the station details have been sent
+	backoff    time.Duration // the last one, 0 after a success
+}
+
+func NewWindy(cfg env.Windy, station env.Station) *Windy {
+	return &Windy{
+		station: windyStation{
+			Station:     cfg.StationID,
+			Name:        cfg.Name,
+			ShareOption: cfg.ShareOption,
+			Lat:         station.Latitude,
+			Lon:         station.Longitude,
+			Elevation:   station.Altitude,
+			TempHeight:  cfg.TempHeight,
+			WindHeight:  cfg.WindHeight,
+		},
+		key:      cfg.APIKey,
+		interval: time.Duration(cfg.FreqMin) * time.Minute,
+		url:      windyUrl,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *Windy) Name() string { return "windy" }
+
+func (w *Windy) Interval() time.Duration { return w.interval }
+
+// body is the json for o, with the station details until windy has them
+func (w *Windy) body(o Observation) ([]byte, error) {
+	d := windyData{
+		Observations: []windyObservation{{
+			Station:  w.station.Station,
+			DateUTC:  o.Time.UTC().Format("2006-01-02T15:04:05"),
+			Temp:     o.TempC,
+			Wind:     convert(o.WindSpeedMph, mphToMs),
+			Gust:     convert(o.WindGustMph, mphToMs),
+			WindDir:  o.WindDir,
+			Humidity: o.Humidity,
+			DewPoint: o.DewPointC,
+			// sea level, in Pa
+			Pressure: convert(o.MSLPHpa, func(p float64) float64 { return p * 100 }),
+			Precip:   o.RainRate,
+		}},
+	}
+	if !w.registered {
+		d.Stations = []windyStation{w.station}
+	}
+	return json.Marshal(d)
+}
+
+func (w *Windy) Upload(ctx context.Context, o Observation) error {
+	body, err := w.body(o)
+	if err != nil {
+		return Permanent(err)
+	}
+	logger.Infof("Sending data to windy [%s]", body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+w.key, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return w.fail(redact(err.Error(), w.key), 0)
+	}
+	defer resp.Body.Close()
+	said, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		w.registered = true
+		w.backoff = 0
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusConflict || resp.StatusCode >= 500:
+		return w.fail(fmt.Sprintf("windy said [%v] [%s]", resp.Status, bytes.TrimSpace(said)), retryAfter(resp.Header.Get("Retry-After")))
+	default:
+		// a bad key or it doesn't like the data, no point waiting
+		return Permanent(fmt.Errorf("windy said [%v] [%s]", resp.Status, bytes.TrimSpace(said)))
+	}
+}
+
+// fail backs off, for at least atLeast if windy said how long
+func (w *Windy) fail(msg string, atLeast time.Duration) error {
+	if w.backoff == 0 {
+		w.backoff = windyBackoff
+	} else {
+		w.backoff = min(w.backoff*2, windyMaxBackoff)
+	}
+	wait := max(w.backoff, atLeast)
+	return Backoff(errors.New(msg), time.Now().Add(wait))
+}
+
+// retryAfter is the Retry-After header in seconds or as a date, 0 if there isn't one
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
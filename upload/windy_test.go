@@ -0,0 +1,80 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindy(t *testing.T) {
+	srv := newFakeServer(t)
+	got := func() windyData {
+		var d windyData
+		require.NoError(t, json.Unmarshal(srv.body, &d))
+		return d
+	}
+
+	w := NewWindy(env.Windy{APIKey: "key", FreqMin: 5, Name: "Culverhay", ShareOption: "Open", WindHeight: 10},
+		env.Station{Latitude: 50.5, Longitude: -3.5, Altitude: 24.71})
+	w.url = srv.URL + "/pws/update/"
+	require.Equal(t, 5*time.Minute, w.Interval())
+
+	o := testObservation()
+	o.Humidity = nil
+	o.WindGustMph = nil
+	ctx := context.Background()
+	require.NoError(t, w.Upload(ctx, o))
+	require.Equal(t, "/pws/update/key", srv.path)
+	sent := got()
+	require.Equal(t, []windyStation{{Name: "Culverhay", ShareOption: "Open", Lat: 50.5, Lon: -3.5, Elevation: 24.71, WindHeight: 10}}, sent.Stations)
+	require.Len(t, sent.Observations, 1)
+	obs := sent.Observations[0]
+	require.Equal(t, "2025-03-01T10:15:00", obs.DateUTC)
+	require.Equal(t, 20.0, *obs.Temp)
+	require.InDelta(t, 2.2352, *obs.Wind, 0.0001)
+	require.InDelta(t, 100288, *obs.Pressure, 0.0001)
+	require.Equal(t, 2.54, *obs.Precip)
+	require.Nil(t, obs.Gust)
+	require.Nil(t, obs.Humidity)
+
+	// the station details only go once
+	require.NoError(t, w.Upload(ctx, o))
+	require.Empty(t, got().Stations)
+
+	// bad key, don't back off, it won't get better
+	srv.status = http.StatusUnauthorized
+	err := w.Upload(ctx, o)
+	require.True(t, isPermanent(err))
+	require.False(t, isBackoff(err))
+
+	// too many, it waits as long as windy says
+	srv.status = http.StatusTooManyRequests
+	srv.header.Set("Retry-After", "600")
+	var b backoff
+	require.ErrorAs(t, w.Upload(ctx, o), &b)
+	require.WithinDuration(t, time.Now().Add(10*time.Minute), b.until, time.Second)
+	require.False(t, isPermanent(b))
+
+	// failures double the backoff
+	srv.status = http.StatusInternalServerError
+	srv.header.Del("Retry-After")
+	require.ErrorAs(t, w.Upload(ctx, o), &b)
+	require.Equal(t, 2*windyBackoff, w.backoff)
+	require.WithinDuration(t, time.Now().Add(2*windyBackoff), b.until, time.Second)
+
+	srv.status = http.StatusOK
+	require.NoError(t, w.Upload(ctx, o))
+	require.Zero(t, w.backoff)
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Equal(t, 2*time.Minute, retryAfter("120"))
+	require.Zero(t, retryAfter(""))
+	require.Zero(t, retryAfter("soon"))
+	require.InDelta(t, time.Hour, retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)), float64(2*time.Second))
+}
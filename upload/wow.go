@@ -0,0 +1,168 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/go-querystring/query"
+	"github.com/gr-butler/weather/env"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+
+https://wow.metoffice.gov.uk/support/dataformats
+
+Key points:
+
+ WOW expects an HTTP request, in the form of either GET or POST, to the following URL. When received, WOW will interpret and validate the information supplied and respond as below.
+
+The URL to send your request to is: http://wow.metoffice.gov.uk/automaticreading? followed by a set of key/value pairs indicating pieces of data.
+
+
+ All uploads must contain 4 pieces of mandatory information plus at least 1 piece of weather data.
+
+    Site ID - siteid:
+    The unique numeric id of the site
+    Authentication Key - siteAuthenticationKey:
+    A pin number, chosen by the user to authenticate with WOW.
+    Date - dateutc:
+    Each observation must have a date, in the date encoding specified below.
+    Software Type - softwaretype
+    The name of the software, to identify which piece of software and which version is uploading data
+
+The date must be in the following format: YYYY-mm-DD HH:mm:ss, where ':' is encoded as %3A, and the space is encoded as either '+' or %20. An example,
+valid date would be: 2011-02-29+10%3A32%3A55, for the 2nd of Feb, 2011 at 10:32:55. Note that the time is in 24 hour format. Also note that the date must be adjusted to UTC time
+
+KEY				Description															UNIT
+
+baromin 		Barometric Pressure (see note) 										Inch of Mercury
+dailyrainin 	Accumulated rainfall so far today 									Inches
+dewptf 			Outdoor Dewpoint 													Fahrenheit
+humidity 		Outdoor Humidity 													0-100 %
+rainin 			Accumulated rainfall since the previous observation 				Inches
+soilmoisture 	% Moisture 															0-100 %
+soiltempf 		Soil Temperature (10cm) 											Fahrenheit
+tempf 			Outdoor Temperature 												Fahrenheit
+visibility 		Visibility 															Kilometres
+winddir 		Instantaneous Wind Direction 										Degrees (0-360)
+windspeedmph 	Instantaneous Wind Speed 											Miles per Hour
+windgustdir 	Current Wind Gust Direction (using software specific time period) 	0-360 degrees
+windgustmph 	Current Wind Gust (using software specific time period) 			Miles per Hour
+
+*/
+//PressureinHg = 29.92 * ( Pressurehpa / 1013.2) = 0.02953 * Pressurehpa
+
+const wowUrl = "http://wow.metoffice.gov.uk/automaticreading?"
+
+// pwsData is the weather in the keys WOW and Weather Underground share, anything
+// that failed QC is nil and left out
+type pwsData struct {
+	RainDayIn    *float64 `url:"dailyrainin,omitempty"`
+	PressureIn   *float64 `url:"baromin,omitempty"`
+	Humidity     *float64 `url:"humidity,omitempty"`
+	TempF        *float64 `url:"tempf,omitempty"`
+	DewPointF    *float64 `url:"dewptf,omitempty"`
+	WindDir      *float64 `url:"winddir,omitempty"`
+	WindSpeedMph *float64 `url:"windspeedmph,omitempty"`
+	WindGustMph  *float64 `url:"windgustmph,omitempty"`
+	WindGustDir  *float64 `url:"windgustdir,omitempty"`
+}
+
+func newPWSData(o Observation) pwsData {
+	return pwsData{
+		RainDayIn: convert(o.RainDayMM, mmToIn),
+		// they want the sea level pressure
+		PressureIn:   convert(o.MSLPHpa, hPaToInHg),
+		Humidity:     o.Humidity,
+		TempF:        convert(o.TempC, cToF),
+		DewPointF:    convert(o.DewPointC, cToF),
+		WindDir:      o.WindDir,
+		WindSpeedMph: o.WindSpeedMph,
+		WindGustMph:  o.WindGustMph,
+		WindGustDir:  o.WindGustDir,
+	}
+}
+
+// wowData is what we send to WOW
+type wowData struct {
+	SiteId       string  `url:"siteid"`
+	AuthKey      string  `url:"siteAuthenticationKey"`
+	DateString   string  `url:"dateutc"`
+	SoftwareType string  `url:"softwaretype"`
+	RainIn       float64 `url:"rainin"` // since the last upload
+	pwsData
+}
+
+// WOW is the Met Office Weather Observations Website
+type WOW struct {
+	siteID   string
+	pin      string
+	software string
+	interval time.Duration
+	url      string
+	client   *http.Client
+}
+
+func NewWOW(cfg env.Wow, software string) *WOW {
+	return &WOW{
+		siteID:   cfg.SiteID,
+		pin:      cfg.Pin,
+		software: software,
+		interval: time.Duration(cfg.FreqMin) * time.Minute,
+		url:      wowUrl,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *WOW) Name() string { return "wow" }
+
+func (w *WOW) Interval() time.Duration { return w.interval }
+
+// values is the query string for o
+func (w *WOW) values(o Observation) string {
+	vals, _ := query.Values(wowData{
+		SiteId:  w.siteID,
+		AuthKey: w.pin,
+		// go magic date is Mon Jan 2 15:04:05 MST 2006
+		// "The date must be in the following format: YYYY-mm-DD HH:mm:ss"
+		DateString:   o.Time.UTC().Format("2006-01-02+15:04:05"),
+		SoftwareType: w.software,
+		RainIn:       mmToIn(o.RainMM),
+		pwsData:      newPWSData(o),
+	})
+	return vals.Encode()
+}
+
+func (w *WOW) Upload(ctx context.Context, o Observation) error {
+	vals := w.values(o)
+	logger.Infof("Sending data to met office [%v]", redact(vals, w.pin))
+	// Metoffice accepts a GET... which is easier so wtf
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.url+vals, nil)
+	if err != nil {
+		return Permanent(err)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.New(redact(err.Error(), w.pin))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("WOW said [%v]", resp.Status)
+		switch {
+		case resp.StatusCode == http.StatusBadRequest:
+			// it doesn't like this observation
+			return Rejected(err)
+		case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+			// the site id or pin is wrong
+			return Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
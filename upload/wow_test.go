@@ -0,0 +1,64 @@
+package upload
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWOW(t *testing.T) {
+	srv := newFakeServer(t)
+
+	w := NewWOW(env.Wow{SiteID: "1234", Pin: "5678", FreqMin: 15}, "test-1.0")
+	w.url = srv.URL + "/automaticreading?"
+	require.Equal(t, 15*time.Minute, w.Interval())
+
+	o := testObservation()
+	o.WindSpeedMph = nil
+	require.NoError(t, w.Upload(context.Background(), o))
+	require.Equal(t, "1234", srv.query.Get("siteid"))
+	require.Equal(t, "5678", srv.query.Get("siteAuthenticationKey"))
+	require.Equal(t, "2025-03-01+10:15:00", srv.query.Get("dateutc"))
+	require.Equal(t, "test-1.0", srv.query.Get("softwaretype"))
+	require.Equal(t, "68", srv.query.Get("tempf"))
+	require.Equal(t, "50", srv.query.Get("dewptf"))
+	require.Equal(t, "0.1", srv.query.Get("rainin"))
+	require.Equal(t, "1", srv.query.Get("dailyrainin"))
+	require.Equal(t, "29.6150464", srv.query.Get("baromin"))
+	require.Equal(t, "90", srv.query.Get("winddir"))
+	// missing or failed QC is left out, not sent as 0
+	require.False(t, srv.query.Has("windspeedmph"))
+
+	o.TempC = nil
+	require.NoError(t, w.Upload(context.Background(), o))
+	require.False(t, srv.query.Has("tempf"))
+
+	srv.status = http.StatusInternalServerError
+	err := w.Upload(context.Background(), o)
+	require.Error(t, err)
+	require.False(t, isPermanent(err))
+
+	// no point trying again with the wrong pin
+	srv.status = http.StatusUnauthorized
+	err = w.Upload(context.Background(), o)
+	require.True(t, isPermanent(err))
+	require.False(t, isRejected(err))
+
+	// or with data it doesn't like
+	srv.status = http.StatusBadRequest
+	require.True(t, isRejected(w.Upload(context.Background(), o)))
+}
+
+func TestWOWKeepsPinOutOfErrors(t *testing.T) {
+	w := NewWOW(env.Wow{SiteID: "1234", Pin: "5678", FreqMin: 15}, "test-1.0")
+	// nothing listening
+	w.url = "http://127.0.0.1:1/automaticreading?"
+	err := w.Upload(context.Background(), testObservation())
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "5678")
+	require.Contains(t, err.Error(), "siteAuthenticationKey=****")
+}
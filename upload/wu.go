@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-querystring/query"
+	"github.com/gr-butler/weather/env"
+	logger "github.com/sirupsen/logrus"
+)
+
+/*
+
+https://support.weather.com/s/article/PWS-Upload-Protocol
+
+Much the same as WOW, a GET with the weather as key/value pairs, the keys are the
+same apart from rainin which is the rain in the last hour. The mandatory ones are
+ID, PASSWORD (the station key), dateutc and action=updateraw.
+
+Rapid fire is the same thing sent to rtupdate every few seconds with realtime=1
+and rtfreq set to the seconds between uploads.
+
+It answers 200 with "success" in the body, anything else went wrong.
+
+*/
+
+const (
+	wuUrl          = "https://weatherstation.wunderground.com/weatherstation/updateweatherstation.php?"
+	wuRapidFireUrl = "https://rtupdate.wunderground.com/weatherstation/updateweatherstation.php?"
+)
+
+// wuData is what we send to Weather Underground
+type wuData struct {
+	ID           string  `url:"ID"`
+	Password     string  `url:"PASSWORD"`
+	Action       string  `url:"action"`
+	DateString   string  `url:"dateutc"`
+	SoftwareType string  `url:"softwaretype"`
+	Realtime     int     `url:"realtime,omitempty"`
+	RtFreq       int     `url:"rtfreq,omitempty"`
+	RainIn       float64 `url:"rainin"` // in the last hour
+	pwsData
+}
+
+// WU is Weather Underground
+type WU struct {
+	id        string
+	key       string
+	software  string
+	interval  time.Duration
+	rapidFire bool
+	url       string
+	client    *http.Client
+}
+
+// NewWU uploads every cfg.FreqMin minutes, or every cfg.RapidFireSeconds if set
+func NewWU(cfg env.WU, software string) *WU {
+	w := &WU{
+		id:       cfg.StationID,
+		key:      cfg.Key,
+		software: software,
+		interval: time.Duration(cfg.FreqMin) * time.Minute,
+		url:      wuUrl,
+		client:   &http.Client{Timeout: timeout},
+	}
+	if cfg.RapidFireSeconds > 0 {
+		w.rapidFire = true
+		w.interval = time.Duration(cfg.RapidFireSeconds) * time.Second
+		w.url = wuRapidFireUrl
+	}
+	return w
+}
+
+func (w *WU) Name() string { return "wunderground" }
+
+func (w *WU) Interval() time.Duration { return w.interval }
+
+// values is the query string for o
+func (w *WU) values(o Observation) string {
+	d := wuData{
+		ID:           w.id,
+		Password:     w.key,
+		Action:       "updateraw",
+		DateString:   o.Time.UTC().Format("2006-01-02 15:04:05"),
+		SoftwareType: w.software,
+		pwsData:      newPWSData(o),
+	}
+	if o.RainRate != nil {
+		d.RainIn = mmToIn(*o.RainRate)
+	}
+	if w.rapidFire {
+		d.Realtime = 1
+		d.RtFreq = int(w.interval.Seconds())
+	}
+	vals, _ := query.Values(d)
+	return vals.Encode()
+}
+
+func (w *WU) Upload(ctx context.Context, o Observation) error {
+	vals := w.values(o)
+	if !w.rapidFire {
+		logger.Infof("Sending data to weather underground [%v]", redact(vals, w.key))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.url+vals, nil)
+	if err != nil {
+		return Permanent(err)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.New(redact(err.Error(), w.key))
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	said := strings.TrimSpace(string(body))
+	if resp.StatusCode == http.StatusOK && strings.Contains(strings.ToLower(said), "success") {
+		return nil
+	}
+	err = fmt.Errorf("weather underground said [%v] [%v]", resp.Status, said)
+	if resp.StatusCode == http.StatusUnauthorized || strings.Contains(said, "INVALIDPASSWORDID") {
+		// the station id or key is wrong
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package upload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gr-butler/weather/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWU(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.reply = "success\n"
+
+	w := NewWU(env.WU{StationID: "IDEVON1", Key: "secret", FreqMin: 5}, "test-1.0")
+	require.Equal(t, wuUrl, w.url)
+	w.url = srv.URL + "/updateweatherstation.php?"
+	require.Equal(t, 5*time.Minute, w.Interval())
+
+	o := testObservation()
+	o.RainMM = 1
+	o.Humidity = nil
+	require.NoError(t, w.Upload(context.Background(), o))
+	require.Equal(t, "IDEVON1", srv.query.Get("ID"))
+	require.Equal(t, "secret", srv.query.Get("PASSWORD"))
+	require.Equal(t, "updateraw", srv.query.Get("action"))
+	require.Equal(t, "2025-03-01 10:15:00", srv.query.Get("dateutc"))
+	require.Equal(t, "68", srv.query.Get("tempf"))
+	require.Equal(t, "50", srv.query.Get("dewptf"))
+	// the last hour, not since the last upload
+	require.Equal(t, "0.1", srv.query.Get("rainin"))
+	require.Equal(t, "1", srv.query.Get("dailyrainin"))
+	require.Equal(t, "29.6150464", srv.query.Get("baromin"))
+	require.Equal(t, "5", srv.query.Get("windspeedmph"))
+	// missing is left out
+	require.False(t, srv.query.Has("humidity"))
+	require.False(t, srv.query.Has("realtime"))
+
+	srv.reply = "INVALIDPASSWORDID|Password or key and/or id are incorrect\n"
+	require.True(t, isPermanent(w.Upload(context.Background(), o)))
+
+	srv.reply = "something went wrong"
+	err := w.Upload(context.Background(), o)
+	require.Error(t, err)
+	require.False(t, isPermanent(err))
+
+	// rapid fire
+	srv.reply = "success\n"
+	w = NewWU(env.WU{StationID: "IDEVON1", Key: "secret", FreqMin: 5, RapidFireSeconds: 5}, "test-1.0")
+	require.Equal(t, wuRapidFireUrl, w.url)
+	w.url = srv.URL + "/updateweatherstation.php?"
+	require.Equal(t, 5*time.Second, w.Interval())
+	require.NoError(t, w.Upload(context.Background(), o))
+	require.Equal(t, "1", srv.query.Get("realtime"))
+	require.Equal(t, "5", srv.query.Get("rtfreq"))
+}